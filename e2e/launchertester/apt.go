@@ -0,0 +1,128 @@
+package launchertester
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// aptSources returns the enabled apt sources of the distro targeted by ctx, one per line in the classic
+// one-line format: "deb http://archive.ubuntu.com/ubuntu noble main restricted". They are collected from
+// /etc/apt/sources.list, and from the .list (one-line format) and .sources (deb822 format) files in
+// /etc/apt/sources.list.d. Options such as "[arch=amd64]" in one-line entries are kept, while deb822 fields
+// other than the types, URIs, suites and components are dropped.
+func aptSources(t *testing.T, ctx context.Context) []string {
+	t.Helper()
+
+	// find fails if sources.list does not exist, but still lists the other files.
+	stdout, _, _ := runWslCommandAsUser(ctx, "root", "find", "/etc/apt/sources.list", "/etc/apt/sources.list.d", "-maxdepth", "1", "-type", "f")
+
+	var sources []string
+	for _, path := range strings.Fields(stdout) {
+		switch {
+		case path == "/etc/apt/sources.list" || strings.HasSuffix(path, ".list"):
+			sources = append(sources, parseOneLineSources(readFile(t, ctx, path))...)
+		case strings.HasSuffix(path, ".sources"):
+			sources = append(sources, parseDeb822Sources(readFile(t, ctx, path))...)
+		}
+	}
+
+	return sources
+}
+
+// parseOneLineSources returns the entries of a sources.list file in the one-line format,
+// with comments stripped and whitespace normalized.
+func parseOneLineSources(contents string) []string {
+	var sources []string
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "deb" && fields[0] != "deb-src" {
+			continue
+		}
+		sources = append(sources, strings.Join(fields, " "))
+	}
+
+	return sources
+}
+
+// parseDeb822Sources returns the entries of a .sources file in the deb822 format, converted to the one-line format.
+// Each stanza yields one entry per combination of type, URI and suite. Stanzas with "Enabled: no" are skipped.
+func parseDeb822Sources(contents string) []string {
+	var sources []string
+
+	flush := func(stanza map[string]string) {
+		if strings.EqualFold(stanza["enabled"], "no") {
+			return
+		}
+
+		components := strings.Fields(stanza["components"])
+		for _, typ := range strings.Fields(stanza["types"]) {
+			for _, uri := range strings.Fields(stanza["uris"]) {
+				for _, suite := range strings.Fields(stanza["suites"]) {
+					sources = append(sources, strings.Join(append([]string{typ, uri, suite}, components...), " "))
+				}
+			}
+		}
+	}
+
+	stanza := make(map[string]string)
+	var lastKey string
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		switch {
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.TrimSpace(line) == "":
+			// A blank line ends the stanza.
+			flush(stanza)
+			stanza = make(map[string]string)
+			lastKey = ""
+		case line[0] == ' ' || line[0] == '\t':
+			// Continuation of a multi-line value, such as an embedded Signed-By key.
+			if lastKey != "" {
+				stanza[lastKey] += " " + strings.TrimSpace(line)
+			}
+		default:
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			lastKey = strings.ToLower(strings.TrimSpace(key))
+			stanza[lastKey] = strings.TrimSpace(value)
+		}
+	}
+	flush(stanza)
+
+	return sources
+}
+
+// assertAptUpdateSucceeds runs "apt-get update" as root in the distro targeted by ctx, retrying on failure,
+// since mirrors can be transiently unavailable. apt-get can exit successfully even when some indexes
+// could not be fetched, so such warnings count as failures too.
+// The network is checked beforehand, so that a network problem is reported as such.
+// Fails if apt-get update has not succeeded before aptUpdateTimeout.
+func assertAptUpdateSucceeds(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	assertNetworkWorks(t, ctx)
+
+	linuxCmd := []string{"apt-get", "update"}
+	retryWslCommand(t, ctx, aptUpdateTimeout, linuxCmd, func(ctx context.Context) (string, string, error) {
+		stdout, stderr, err := runWslCommandAsUser(ctx, "root", linuxCmd...)
+		if err == nil && strings.Contains(stderr, "Failed to fetch") {
+			err = errors.New("some indexes could not be fetched:\n" + stderr)
+		}
+		return stdout, stderr, err
+	})
+}
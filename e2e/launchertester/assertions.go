@@ -0,0 +1,160 @@
+package launchertester
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertWslOutputMatches runs the Linux command in the distro under test, and returns its stdout.
+// Fails if the command does not succeed, or if its stdout does not match the regular expression.
+func assertWslOutputMatches(t *testing.T, ctx context.Context, pattern string, linuxCmd ...string) string {
+	t.Helper()
+
+	out := assertWslCommand(t, ctx, linuxCmd...)
+	assertMatches(t, pattern, out)
+
+	return out
+}
+
+// assertLauncherOutputMatches runs the launcher with the specified verb and arguments, and returns its stdout.
+// Fails if the launcher does not succeed, or if its stdout does not match the regular expression.
+func assertLauncherOutputMatches(t *testing.T, ctx context.Context, pattern string, verb string, args ...string) string {
+	t.Helper()
+
+	out := assertLauncherCommand(t, ctx, verb, args...)
+	assertMatches(t, pattern, out)
+
+	return out
+}
+
+// assertWslOutput runs the Linux command in the distro under test, and returns its stdout.
+// Fails if the command does not succeed, or if its stdout differs from want once whitespace is normalized
+// (see normalizeWhitespace).
+func assertWslOutput(t *testing.T, ctx context.Context, want string, linuxCmd ...string) string {
+	t.Helper()
+
+	out := assertWslCommand(t, ctx, linuxCmd...)
+	assertOutputEquals(t, want, out)
+
+	return out
+}
+
+// assertWslOutputLines is like assertWslOutput, but compares the output line by line.
+// Empty lines at the end of the output are ignored.
+func assertWslOutputLines(t *testing.T, ctx context.Context, want []string, linuxCmd ...string) string {
+	t.Helper()
+
+	out := assertWslCommand(t, ctx, linuxCmd...)
+
+	got := strings.Split(strings.TrimRight(out, "\r\n"), "\n")
+	for i := range got {
+		got[i] = normalizeWhitespace(got[i])
+	}
+	wantNormalized := make([]string, len(want))
+	for i := range want {
+		wantNormalized[i] = normalizeWhitespace(want[i])
+	}
+
+	// Equal prints a diff of both slices on mismatch.
+	require.Equalf(t, wantNormalized, got, "Unexpected output lines of %q", linuxCmd)
+
+	return out
+}
+
+// assertOutputEquals fails if the output differs from want once whitespace is normalized.
+// A diff between the two is printed on mismatch.
+func assertOutputEquals(t *testing.T, want, out string) {
+	t.Helper()
+
+	require.Equal(t, normalizeWhitespace(want), normalizeWhitespace(out), "Unexpected output")
+}
+
+// normalizeWhitespace trims s, and replaces every run of spaces and tabs with a single space and
+// every line ending with a single "\n", so that formatting differences do not matter in comparisons.
+func normalizeWhitespace(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, l := range lines {
+		lines[i] = strings.Join(strings.Fields(l), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// assertMatches fails if the output does not match the regular expression.
+func assertMatches(t *testing.T, pattern, out string) {
+	t.Helper()
+
+	re, err := regexp.Compile(pattern)
+	require.NoErrorf(t, err, "Setup: invalid regular expression %q", pattern)
+	require.Truef(t, re.MatchString(out), "Output does not match the regular expression.\nPattern: %s\nOutput: %s", pattern, out)
+}
+
+// assertLineMatches fails if no single line of the output matches the regular expression.
+// Carriage returns at the end of lines are ignored.
+func assertLineMatches(t *testing.T, pattern, out string) {
+	t.Helper()
+
+	re, err := regexp.Compile(pattern)
+	require.NoErrorf(t, err, "Setup: invalid regular expression %q", pattern)
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if re.MatchString(strings.TrimRight(scanner.Text(), "\r")) {
+			return
+		}
+	}
+	require.NoError(t, scanner.Err(), "Error scanning output")
+
+	require.Failf(t, "No line of the output matches the regular expression", "Pattern: %s\nOutput: %s", pattern, out)
+}
+
+// assertWslJSON runs the Linux command in the distro under test, and unmarshals its stdout into out,
+// which must be a pointer.
+// Fails if the command does not succeed, or if its stdout cannot be unmarshalled.
+func assertWslJSON(t *testing.T, ctx context.Context, out any, linuxCmd ...string) {
+	t.Helper()
+
+	stdout := assertWslCommand(t, ctx, linuxCmd...)
+	err := json.Unmarshal([]byte(stdout), out)
+	require.NoErrorf(t, err, "Could not unmarshal the output of %q as JSON.\nOutput: %s", linuxCmd, stdout)
+}
+
+// wslCase is a Linux command to run in the distro under test, along with what to expect from it.
+type wslCase struct {
+	name string
+	args []string
+
+	// asUser is the user to run the command as. The default user is used if empty.
+	asUser string
+
+	wantExit        int
+	wantOutContains string
+}
+
+// runCases runs every case as a subtest named after it, in the distro targeted by ctx.
+// The exit code is checked as assertWslExitCode does, and independently of the output, so that
+// each failure states which expectation was violated.
+func runCases(t *testing.T, ctx context.Context, cases []wslCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr string
+			var err error
+			if tc.asUser == "" {
+				stdout, stderr, err = runWslCommand(ctx, tc.args...)
+			} else {
+				stdout, stderr, err = runWslCommandAsUser(ctx, tc.asUser, tc.args...)
+			}
+
+			checkWslExitCode(t, tc.wantExit, tc.args, stdout, stderr, err)
+			assert.Containsf(t, stdout, tc.wantOutContains, "Output expectation violated for %q", tc.args)
+		})
+	}
+}
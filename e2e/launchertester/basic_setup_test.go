@@ -11,24 +11,47 @@ import (
 
 // TestBasicSetup runs a battery of assertions after installing with the distro launcher.
 func TestBasicSetup(t *testing.T) {
-	wslSetup(t)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 	// TODO: try to inject user/password to stdin to avoid --root arg.
-	out, err := launcherCommand(ctx, "install", "--root").CombinedOutput() // Installing as root to avoid Stdin
-	require.NoErrorf(t, err, "Unexpected error installing: %s\n%v", out, err)
+	out := freshInstall(t, ctx, launcherInstallOptions{root: true}) // Installing as root to avoid Stdin
 	// TODO: check with Carlos if this is necessary
 	require.NotEmpty(t, out, "Failed to install the distro: No output produced.")
 
+	// Installing with --root creates no user to escalate with sudo: the sudo cases run in TestHeadlessSetup.
 	testCases := map[string]func(t *testing.T){
 		// TODO: Re-enable those tests once the latest wsl-setup with distro patching land.
 		// "SystemdEnabled":          testSystemdEnabled,
 		// "SystemdUnits":            testSystemdUnits,
 		// "CorrectUpgradePolicy":    testCorrectUpgradePolicy,
 		// "UpgradePolicyIdempotent": testUpgradePolicyIdempotent,
-		"InteropIsEnabled": testInteropIsEnabled,
-		"HelpFlag":         testHelpFlag,
+		"InteropIsEnabled":           testInteropIsEnabled,
+		"HelpFlag":                   testHelpFlag,
+		"ExitCodeIsForwarded":        testExitCodeIsForwarded,
+		"DistroIsUbuntu":             testDistroIsUbuntu,
+		"ConcurrentCommands":         testConcurrentCommands,
+		"CancelStopsCommands":        testCancelStopsCommands,
+		"StdinIsForwarded":           testStdinIsForwarded,
+		"CommandsRunInDir":           testCommandsRunInDir,
+		"DiskIsCreated":              testDiskIsCreated,
+		"WindowsDriveIsMounted":      testWindowsDriveIsMounted,
+		"ColdStartIsFast":            testColdStartIsFast,
+		"LauncherRejectsInvalidArgs": testLauncherRejectsInvalidArgs,
+		"SetDefaultUser":             testSetDefaultUser,
+		"NetworkWorks":               testNetworkWorks,
+		"UserShellIsBash":            testUserShellIsBash,
+		"AptIsConfigured":            testAptIsConfigured,
+		"ResolvedIsActive":           testResolvedIsActive,
+		"ServiceCanBeStopped":        testServiceCanBeStopped,
+		"WSLgIsAvailable":            testWSLgIsAvailable,
+		"HostsAreGenerated":          testHostsAreGenerated,
+		"CustomHostname":             testCustomHostname,
+		"FilesPersistAcrossShutdown": testFilesPersistAcrossShutdown,
+		"EnvironmentIsSet":           testEnvironmentIsSet,
+		"InstallIsIdempotent":        testInstallIsIdempotent,
+		"UnregisterCleansUp":         testUnregisterCleansUp,
+		"CopyFilesRoundTrip":         testCopyFilesRoundTrip,
+		"KernelIsWSL2":               testKernelIsWSL2,
 	}
 
 	for name, tc := range testCases {
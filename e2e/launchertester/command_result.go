@@ -0,0 +1,85 @@
+package launchertester
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputTailLines is the number of lines of output included in the message of a commandError.
+const outputTailLines = 50
+
+// commandResult describes how a command ran.
+type commandResult struct {
+	cmdLine  string
+	exitCode int
+	elapsed  time.Duration
+
+	// step is the assertion step the command was run in, if any.
+	step string
+
+	// output is the combined stdout and stderr, in the order they were written.
+	output string
+}
+
+// commandError is the error returned by runCommand when a command fails.
+// Its message describes the command and how it ran, so that failures are debuggable from the logs alone.
+type commandError struct {
+	commandResult
+	err error
+}
+
+// Error returns a multi-line description of the failed command.
+func (e *commandError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "command failed: %v\n", e.err)
+	if e.step != "" {
+		fmt.Fprintf(&b, "  Step:      %s\n", e.step)
+	}
+	fmt.Fprintf(&b, "  Command:   %s\n", e.cmdLine)
+	fmt.Fprintf(&b, "  Exit code: %d\n", e.exitCode)
+	fmt.Fprintf(&b, "  Elapsed:   %s\n", e.elapsed.Round(time.Millisecond))
+
+	lines := strings.Split(strings.TrimRight(e.output, "\r\n"), "\n")
+	if len(lines) > outputTailLines {
+		fmt.Fprintf(&b, "  Output (last %d of %d lines):\n", outputTailLines, len(lines))
+		lines = lines[len(lines)-outputTailLines:]
+	} else {
+		fmt.Fprint(&b, "  Output:\n")
+	}
+	for _, l := range lines {
+		fmt.Fprintf(&b, "    %s\n", strings.TrimRight(l, "\r"))
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// lockedBuffer is a bytes.Buffer that can be written into concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write appends p to the buffer.
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// String returns the contents of the buffer.
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
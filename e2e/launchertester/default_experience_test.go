@@ -45,6 +45,12 @@ func TestDefaultExperience(t *testing.T) {
 
 	testCases := map[string]func(t *testing.T){
 		"UserNotRoot":             testUserNotRoot,
+		"UserIsSudoer":            testUserIsSudoer,
+		"SudoRequiresPassword":    testSudoRequiresPassword,
+		"DefaultUserNotRoot":      testDefaultUserNotRoot,
+		"DefaultUIDNotZero":       testDefaultUIDNotZero,
+		"UserHomeDirectory":       testUserHomeDirectory,
+		"UserShellIsBash":         testUserShellIsBash,
 		"SystemdEnabled":          testSystemdEnabled,
 		"SystemdUnits":            testSystemdUnits,
 		"CorrectUpgradePolicy":    testCorrectUpgradePolicy,
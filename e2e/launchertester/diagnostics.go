@@ -0,0 +1,105 @@
+package launchertester
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+var diagnosticsRoot = flag.String("diagnostics-dir", "", "Directory where diagnostics are collected when a test fails. Defaults to a new directory in the system's temporary directory.")
+
+// defaultDiagnosticsRoot creates the directory used when --diagnostics-dir is not set, shared by all tests.
+var defaultDiagnosticsRoot = sync.OnceValues(func() (string, error) {
+	return os.MkdirTemp("", "launchertester-diagnostics-")
+})
+
+// diagnosticsDir returns the directory where the diagnostics of the test are collected.
+// Unlike t.TempDir, it is not removed at the end of the test, so that it can be inspected or uploaded.
+// It returns an empty string if the directory cannot be determined.
+func diagnosticsDir(t *testing.T) string {
+	t.Helper()
+
+	root := *diagnosticsRoot
+	if root == "" {
+		var err error
+		if root, err = defaultDiagnosticsRoot(); err != nil {
+			t.Logf("Could not create diagnostics directory: %v", err)
+			return ""
+		}
+	}
+
+	name := regexp.MustCompile(`[^a-zA-Z0-9._-]+`).ReplaceAllString(t.Name(), "_")
+	return filepath.Join(root, name)
+}
+
+// collectDiagnostics dumps the state of WSL and of the distro under test into diagnosticsDir if the test failed.
+// Failing to collect a piece of diagnostics is logged but does not prevent collecting the others.
+func collectDiagnostics(t *testing.T) {
+	t.Helper()
+
+	if !t.Failed() {
+		return
+	}
+
+	dir := diagnosticsDir(t)
+	if dir == "" {
+		return
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Logf("Could not create diagnostics directory: %v", err)
+		return
+	}
+
+	t.Logf("Test failed: collecting diagnostics into %s", dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	host := map[string][]string{
+		"wsl-status.txt":  {"wsl.exe", "--status"},
+		"wsl-version.txt": {"wsl.exe", "--version"},
+		"wsl-list.txt":    {"wsl.exe", "--list", "--verbose"},
+	}
+
+	for file, args := range host {
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		writeDiagnostics(t, dir, file, decodeWslOutput(out), err)
+	}
+
+	if !isRegistered(t) {
+		t.Logf("Distro %q is not registered: skipping diagnostics from inside the distro", *distroName)
+		return
+	}
+
+	distro := map[string][]string{
+		"wsl.conf":     {"cat", "/etc/wsl.conf"},
+		"dmesg.txt":    {"dmesg"},
+		"var-log.txt":  {"sh", "-c", "tail -n 200 /var/log/*.log /var/log/installer/*.log"},
+		"journal.txt":  {"journalctl", "--no-pager", "--boot", "--lines=500"},
+		"packages.txt": {"dpkg", "-l"},
+	}
+
+	for file, linuxCmd := range distro {
+		stdout, stderr, err := runWslCommandAsUser(ctx, "root", linuxCmd...)
+		writeDiagnostics(t, dir, file, stdout+stderr, err)
+	}
+}
+
+// writeDiagnostics writes the output of a diagnostics command into a file in dir, followed by the
+// error of the command, if any.
+func writeDiagnostics(t *testing.T, dir, file, out string, cmdErr error) {
+	t.Helper()
+
+	if cmdErr != nil {
+		out += "\n---\nError: " + cmdErr.Error() + "\n"
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(out), 0600); err != nil {
+		t.Logf("Could not write diagnostics file %s: %v", file, err)
+	}
+}
@@ -0,0 +1,687 @@
+package launchertester
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/ini.v1"
+)
+
+// readFile returns the contents of the file at the specified path inside the distro, read as root.
+// A single trailing newline is trimmed.
+// Fails if the file cannot be read.
+func readFile(t *testing.T, ctx context.Context, path string) string {
+	t.Helper()
+
+	out, _, err := runRootExec(ctx, "cat", path)
+	require.NoErrorf(t, err, "Could not read %s", path)
+
+	return strings.TrimSuffix(out, "\n")
+}
+
+// assertFileContains fails if the file at the specified path inside the distro does not contain substr.
+func assertFileContains(t *testing.T, ctx context.Context, path, substr string) {
+	t.Helper()
+
+	require.Containsf(t, readFile(t, ctx, path), substr, "File %s does not contain the expected text", path)
+}
+
+// assertFileEquals fails if the contents of the file at the specified path inside the distro are not the
+// expected ones. A single trailing newline is ignored.
+func assertFileEquals(t *testing.T, ctx context.Context, path, want string) {
+	t.Helper()
+
+	want = strings.TrimSuffix(want, "\n")
+	require.Equalf(t, want, readFile(t, ctx, path), "File %s does not have the expected contents", path)
+}
+
+// fileExists returns true if a file or directory exists at the specified path inside the distro targeted by ctx.
+// Fails if this cannot be determined.
+func fileExists(t *testing.T, ctx context.Context, path string) bool {
+	t.Helper()
+
+	_, _, err := runRootExec(ctx, "test", "-e", path)
+	if exitCode(err) == 1 {
+		return false
+	}
+	require.NoErrorf(t, err, "Could not check if %s exists", path)
+
+	return true
+}
+
+// assertFileExists fails if no file or directory exists at the specified path inside the distro targeted by ctx.
+func assertFileExists(t *testing.T, ctx context.Context, path string) {
+	t.Helper()
+
+	require.Truef(t, fileExists(t, ctx, path), "%s should exist", path)
+}
+
+// assertCommandCreatesFile runs the Linux command in the distro targeted by ctx, and returns its stdout.
+// Fails if a file or directory already existed at the specified path before running the command, so that
+// the assertion cannot pass vacuously, if the command does not succeed, or if nothing exists at the path afterwards.
+func assertCommandCreatesFile(t *testing.T, ctx context.Context, path string, linuxCmd ...string) string {
+	t.Helper()
+
+	require.Falsef(t, fileExists(t, ctx, path), "Setup: %s should not exist before running %q", path, linuxCmd)
+
+	out := assertWslCommand(t, ctx, linuxCmd...)
+	require.Truef(t, fileExists(t, ctx, path), "Running %q should have created %s", linuxCmd, path)
+
+	return out
+}
+
+// assertCommandCreatesNonEmptyFile is like assertCommandCreatesFile, but also fails if the created file is empty.
+func assertCommandCreatesNonEmptyFile(t *testing.T, ctx context.Context, path string, linuxCmd ...string) string {
+	t.Helper()
+
+	out := assertCommandCreatesFile(t, ctx, path, linuxCmd...)
+
+	_, _, err := runRootExec(ctx, "test", "-s", path)
+	require.NoErrorf(t, err, "Running %q should have created %s with some contents", linuxCmd, path)
+
+	return out
+}
+
+// fileMode returns the permission bits of the file or directory at the specified path inside the
+// distro targeted by ctx.
+// Fails if the file does not exist.
+func fileMode(t *testing.T, ctx context.Context, path string) os.FileMode {
+	t.Helper()
+
+	out, _, err := runRootExec(ctx, "stat", "-c", "%a", path)
+	require.NoErrorf(t, err, "Could not find the mode of %s", path)
+
+	out = strings.TrimSpace(out)
+	mode, err := strconv.ParseUint(out, 8, 32)
+	require.NoErrorf(t, err, "Could not parse the mode of %s: %q", path, out)
+
+	return os.FileMode(mode)
+}
+
+// assertFileMode fails if the permission bits of the file or directory at the specified path inside the
+// distro targeted by ctx are not the expected ones. It returns the actual mode for finer-grained checks.
+func assertFileMode(t *testing.T, ctx context.Context, path string, want os.FileMode) os.FileMode {
+	t.Helper()
+
+	got := fileMode(t, ctx, path)
+	require.Equalf(t, want, got, "Unexpected mode for %s: got %#o, want %#o", path, got, want)
+
+	return got
+}
+
+// currentUser returns the name of the user that commands run as by default in the distro targeted by ctx.
+func currentUser(t *testing.T, ctx context.Context) string {
+	t.Helper()
+
+	return strings.TrimSpace(assertWslCommand(t, ctx, "whoami"))
+}
+
+// assertUserExists fails if the user does not exist in the distro targeted by ctx.
+func assertUserExists(t *testing.T, ctx context.Context, name string) {
+	t.Helper()
+
+	_, _, err := runWslCommand(ctx, "id", name)
+	require.NoErrorf(t, err, "User %q should exist", name)
+}
+
+// assertUserInGroup fails if the user is not a member of the group in the distro targeted by ctx.
+func assertUserInGroup(t *testing.T, ctx context.Context, name, group string) {
+	t.Helper()
+
+	require.Containsf(t, userGroups(t, ctx, name), group, "User %q should be a member of group %q", name, group)
+}
+
+// unixUser is the account information of a user, as found in its passwd entry.
+type unixUser struct {
+	name  string
+	uid   int
+	gid   int
+	gecos string
+	home  string
+	shell string
+}
+
+// userNotFoundError is returned by accountInfo when the user does not exist.
+type userNotFoundError struct {
+	name string
+}
+
+// Error returns a description of the error.
+func (e userNotFoundError) Error() string {
+	return fmt.Sprintf("user %q does not exist", e.name)
+}
+
+// accountInfo returns the account information of the user in the distro targeted by ctx, parsed
+// from the output of "getent passwd". A userNotFoundError is returned if the user does not exist.
+func accountInfo(ctx context.Context, name string) (*unixUser, error) {
+	stdout, _, err := runWslCommand(ctx, "getent", "passwd", name)
+	if exitCode(err) == 2 { // Key not found
+		return nil, userNotFoundError{name: name}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the passwd entry of user %q: %w", name, err)
+	}
+
+	// Example entry:
+	// ubuntu:x:1000:1000:Ubuntu,,,:/home/ubuntu:/bin/bash
+	fields := strings.Split(strings.TrimSpace(stdout), ":")
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("unexpected passwd entry for user %q: %q", name, stdout)
+	}
+
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse UID in passwd entry %q: %v", stdout, err)
+	}
+	gid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse GID in passwd entry %q: %v", stdout, err)
+	}
+
+	return &unixUser{
+		name:  fields[0],
+		uid:   uid,
+		gid:   gid,
+		gecos: fields[4],
+		home:  fields[5],
+		shell: fields[6],
+	}, nil
+}
+
+// userGroups returns the names of the groups the user is a member of in the distro targeted by ctx.
+// Fails if the user does not exist.
+func userGroups(t *testing.T, ctx context.Context, name string) []string {
+	t.Helper()
+
+	return strings.Fields(assertWslCommand(t, ctx, "id", "-nG", name))
+}
+
+// userShell returns the login shell of the user in the distro targeted by ctx, as
+// set in the seventh field of its line in /etc/passwd.
+// It returns a userNotFoundError if the user does not exist.
+func userShell(ctx context.Context, name string) (string, error) {
+	u, err := accountInfo(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return u.shell, nil
+}
+
+// assertUserShell fails if the login shell of the user in the distro targeted by ctx is not the expected one.
+func assertUserShell(t *testing.T, ctx context.Context, name, want string) {
+	t.Helper()
+
+	shell, err := userShell(ctx, name)
+	require.NoError(t, err, "Could not find the login shell")
+	require.Equalf(t, want, shell, "Unexpected login shell for user %q", name)
+}
+
+// defaultUser returns the name of the default user configured for the distro targeted by ctx.
+// It is read from the [user] section of /etc/wsl.conf and, if not set there, from the DefaultUid
+// value that WSL stores in the registry.
+func defaultUser(ctx context.Context) (string, error) {
+	cfg, err := loadWslConf(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if user := cfg.Section("user").Key("default").String(); user != "" {
+		return user, nil
+	}
+
+	uid, err := registryDefaultUID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	stdout, _, err := runWslCommandAsUser(ctx, "root", "id", "-nu", strconv.Itoa(uid))
+	if err != nil {
+		return "", fmt.Errorf("could not find the name of user with UID %d: %w", uid, err)
+	}
+
+	return strings.TrimSpace(stdout), nil
+}
+
+// assertDefaultUserIsNotRoot fails if the default user configured for the distro targeted by ctx is root.
+func assertDefaultUserIsNotRoot(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	user, err := defaultUser(ctx)
+	require.NoError(t, err, "Could not find the configured default user")
+	require.NotEqual(t, "root", user, "Configured default user should not be root")
+}
+
+// registryDefaultUID returns the DefaultUid that WSL stores in the registry for the distro targeted by ctx.
+func registryDefaultUID(ctx context.Context) (int, error) {
+	distro := targetDistro(ctx)
+
+	script := fmt.Sprintf(`Get-ChildItem HKCU:\Software\Microsoft\Windows\CurrentVersion\Lxss | `+
+		`Where-Object { $_.GetValue('DistributionName') -eq %s } | `+
+		`ForEach-Object { $_.GetValue('DefaultUid') }`, powershellQuote(distro))
+
+	out, _, err := runPowerShell(ctx, script)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the registry of distro %q: %w", distro, err)
+	}
+
+	uid, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("could not parse DefaultUid of distro %q from the registry: %v. Output: %s", distro, err, out)
+	}
+
+	return uid, nil
+}
+
+// assertDefaultUIDNotZero fails if the DefaultUid stored in the registry for the distro targeted by ctx is
+// that of root. This is the setting WSL actually honors, regardless of what wsl.conf says.
+func assertDefaultUIDNotZero(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	uid, err := registryDefaultUID(ctx)
+	require.NoError(t, err, "Could not find the default UID in the registry")
+	require.NotZero(t, uid, "Default UID in the registry should not be that of root")
+}
+
+// loadWslConf reads and parses /etc/wsl.conf in the distro targeted by ctx.
+// An empty configuration is returned if the file does not exist.
+func loadWslConf(ctx context.Context) (*ini.File, error) {
+	stdout, _, err := runRootExec(ctx, "cat", "/etc/wsl.conf")
+	if exitCode(err) == 1 { // wsl.conf does not exist
+		return ini.Empty(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read /etc/wsl.conf: %w", err)
+	}
+
+	cfg, err := ini.Load([]byte(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse /etc/wsl.conf: %v", err)
+	}
+
+	return cfg, nil
+}
+
+// systemdEnabled returns true if systemd is enabled in /etc/wsl.conf and is actually running as PID 1
+// in the distro targeted by ctx.
+// The result is not cached: tests may edit wsl.conf and restart the distro, which changes it.
+// Fails if this cannot be determined.
+func systemdEnabled(t *testing.T, ctx context.Context) bool {
+	t.Helper()
+
+	cfg, err := loadWslConf(ctx)
+	require.NoError(t, err, "Could not find out if systemd is enabled")
+
+	if enabled, err := cfg.Section("boot").Key("systemd").Bool(); err != nil || !enabled {
+		return false
+	}
+
+	return strings.TrimSpace(assertWslCommand(t, ctx, "ps", "-p", "1", "-o", "comm=")) == "systemd"
+}
+
+// skipIfNoSystemd skips the test if systemd is not enabled in the distro targeted by ctx.
+func skipIfNoSystemd(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	if !systemdEnabled(t, ctx) {
+		t.Skipf("Skipped: systemd is not enabled in distro %q", targetDistro(ctx))
+	}
+}
+
+// serviceState returns the state of the systemd unit in the distro targeted by ctx, as reported by "systemctl is-active":
+// "active", "inactive", "failed", etc. The test is skipped if systemd is not enabled.
+func serviceState(t *testing.T, ctx context.Context, name string) string {
+	t.Helper()
+
+	skipIfNoSystemd(t, ctx)
+
+	stdout, _, err := runWslCommand(ctx, "systemctl", "is-active", name)
+	if exitCode(err) != 3 { // Unit not active: only the output matters
+		require.NoErrorf(t, err, "Could not query the state of service %q", name)
+	}
+
+	return strings.TrimSpace(stdout)
+}
+
+// assertServiceActive fails if the systemd unit is not active in the distro targeted by ctx.
+// The test is skipped if systemd is not enabled.
+func assertServiceActive(t *testing.T, ctx context.Context, name string) {
+	t.Helper()
+
+	require.Equalf(t, "active", serviceState(t, ctx, name), "Service %q should be active", name)
+}
+
+// assertServiceInactive fails if the systemd unit is active or failed in the distro targeted by ctx.
+// Units that do not exist count as inactive. The test is skipped if systemd is not enabled.
+func assertServiceInactive(t *testing.T, ctx context.Context, name string) {
+	t.Helper()
+
+	require.Equalf(t, "inactive", serviceState(t, ctx, name), "Service %q should be inactive", name)
+}
+
+// packageStatus parses the output of "dpkg -s" for the package in the distro targeted by ctx, and returns
+// its status and version. An empty status is returned if the package is not known to dpkg.
+func packageStatus(t *testing.T, ctx context.Context, pkg string) (status, version string) {
+	t.Helper()
+
+	stdout, _, err := runWslCommand(ctx, "dpkg", "-s", pkg)
+	if exitCode(err) == 1 { // Package not known
+		return "", ""
+	}
+	require.NoErrorf(t, err, "Could not query the status of package %q", pkg)
+
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Status":
+			status = strings.TrimSpace(value)
+		case "Version":
+			version = strings.TrimSpace(value)
+		}
+	}
+	require.NoError(t, scanner.Err(), "Error scanning output of dpkg")
+
+	return status, version
+}
+
+// packageVersion returns the installed version of the package in the distro targeted by ctx.
+// Fails if the package is not installed.
+func packageVersion(t *testing.T, ctx context.Context, pkg string) string {
+	t.Helper()
+
+	assertPackageInstalled(t, ctx, pkg)
+	_, version := packageStatus(t, ctx, pkg)
+
+	return version
+}
+
+// assertPackageInstalled fails if the package is not fully installed in the distro targeted by ctx,
+// as opposed to merely marked for installation.
+// The package can be a glob pattern such as "language-pack-*", in which case at least one package must
+// match, and all of the matching packages must be installed.
+func assertPackageInstalled(t *testing.T, ctx context.Context, pkg string) {
+	t.Helper()
+
+	if !strings.ContainsAny(pkg, "*?[") {
+		status, _ := packageStatus(t, ctx, pkg)
+		require.Equalf(t, "install ok installed", status, "Package %q should be installed", pkg)
+		return
+	}
+
+	stdout, _, err := runWslCommand(ctx, "dpkg", "-l", pkg)
+	require.NoErrorf(t, err, "No package matching %q is known", pkg)
+
+	// Example line:
+	// ii  language-pack-en  1:22.04+20230801  all  translation updates for language English
+	// ↑↑  ↑~~~~~~~~~~~~~~~
+	// ||  Package name
+	// |Current state (i: installed)
+	// Desired state
+	var matches int
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || len(fields[0]) < 2 || !strings.ContainsRune("uihrp", rune(fields[0][0])) {
+			continue // Headers
+		}
+		if fields[0][1] == 'n' {
+			continue // Matching name unknown to dpkg
+		}
+		matches++
+		assert.Equalf(t, "ii", fields[0], "Package %q matching %q should be installed", fields[1], pkg)
+	}
+	require.NoError(t, scanner.Err(), "Error scanning output of dpkg")
+	require.NotZerof(t, matches, "No installed package matches %q", pkg)
+}
+
+// osRelease parses /etc/os-release in the distro targeted by ctx into its key-value pairs.
+// Quotes around values are removed, and comments and blank lines are ignored.
+func osRelease(ctx context.Context) (map[string]string, error) {
+	stdout, _, err := runWslCommand(ctx, "cat", "/etc/os-release")
+	if err != nil {
+		return nil, fmt.Errorf("could not read /etc/os-release: %w", err)
+	}
+
+	return parseOSRelease(stdout), nil
+}
+
+// parseOSRelease parses the contents of an os-release file into its key-value pairs.
+// See https://www.freedesktop.org/software/systemd/man/os-release.html
+func parseOSRelease(contents string) map[string]string {
+	fields := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		fields[key] = value
+	}
+
+	return fields
+}
+
+// distroID returns the ID field of /etc/os-release in the distro targeted by ctx, e.g. "ubuntu".
+// Fails if it cannot be read.
+func distroID(t *testing.T, ctx context.Context) string {
+	t.Helper()
+
+	fields, err := osRelease(ctx)
+	require.NoError(t, err, "Could not find the distro ID")
+
+	return fields["ID"]
+}
+
+// versionCodename returns the VERSION_CODENAME field of /etc/os-release in the distro targeted by ctx,
+// e.g. "jammy".
+// Fails if it cannot be read.
+func versionCodename(t *testing.T, ctx context.Context) string {
+	t.Helper()
+
+	fields, err := osRelease(ctx)
+	require.NoError(t, err, "Could not find the version codename")
+
+	return fields["VERSION_CODENAME"]
+}
+
+// envVar returns the value of the environment variable as seen by the default user's login shell in
+// the distro targeted by ctx, so that variables set by profile scripts are accounted for.
+// An empty string is returned if the variable is not set.
+func envVar(t *testing.T, ctx context.Context, name string) string {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	stdout, _, err := runCommand(ctx, wslLoginCommand(ctx, "printenv", name))
+	if exitCode(err) == 1 { // Not set
+		return ""
+	}
+	require.NoErrorf(t, err, "Could not read environment variable %s", name)
+
+	return strings.TrimRight(stdout, "\n")
+}
+
+// assertEnvVarContains fails if the environment variable, as seen by the default user's login shell in the
+// distro targeted by ctx, does not contain substr.
+func assertEnvVarContains(t *testing.T, ctx context.Context, name, substr string) {
+	t.Helper()
+
+	value := envVar(t, ctx, name)
+	require.Containsf(t, value, substr, "Environment variable %s does not contain the expected value", name)
+}
+
+// assertLocale fails if the default locale of the distro targeted by ctx is not the expected one,
+// or if that locale has not been generated.
+// Codesets are normalized, so "en_US.UTF-8" and "en_US.utf8" are equivalent.
+func assertLocale(t *testing.T, ctx context.Context, want string) {
+	t.Helper()
+
+	want = normalizeLocale(want)
+
+	cfg, err := ini.Load([]byte(readFile(t, ctx, "/etc/default/locale")))
+	require.NoError(t, err, "Could not parse /etc/default/locale")
+
+	got := normalizeLocale(cfg.Section("").Key("LANG").String())
+	require.Equal(t, want, got, "Unexpected LANG in /etc/default/locale")
+
+	var generated []string
+	for _, l := range strings.Fields(assertWslCommand(t, ctx, "locale", "-a")) {
+		generated = append(generated, normalizeLocale(l))
+	}
+	require.Containsf(t, generated, want, "Locale %s should have been generated", want)
+}
+
+// normalizeLocale returns the locale with its codeset in the canonical form used by "locale -a":
+// lowercase and without dashes, e.g. "en_US.UTF-8" becomes "en_US.utf8".
+func normalizeLocale(locale string) string {
+	name, rest, found := strings.Cut(locale, ".")
+	if !found {
+		return locale
+	}
+
+	codeset, modifier, hasModifier := strings.Cut(rest, "@")
+	codeset = strings.ToLower(strings.ReplaceAll(codeset, "-", ""))
+
+	if hasModifier {
+		return name + "." + codeset + "@" + modifier
+	}
+	return name + "." + codeset
+}
+
+// sudoMode is the way sudo is expected to behave for a user.
+type sudoMode int
+
+const (
+	// sudoRequiresPassword means the user can use sudo after authenticating.
+	sudoRequiresPassword sudoMode = iota
+	// sudoPasswordless means the user can use sudo without authenticating.
+	sudoPasswordless
+)
+
+// assertSudo fails if sudo does not behave as expected for the default user of the distro targeted by ctx.
+// The user must be allowed to use sudo in either mode.
+func assertSudo(t *testing.T, ctx context.Context, mode sudoMode) {
+	t.Helper()
+
+	user := currentUser(t, ctx)
+
+	// sudo -l lists the privileges of the user, without requiring authentication.
+	privileges := assertWslCommandAsUser(t, ctx, "root", "sudo", "-l", "-U", user)
+	require.NotContainsf(t, privileges, "is not allowed to run sudo", "User %q should be allowed to use sudo", user)
+
+	// -n (non-interactive) makes sudo fail instead of prompting when a password is required.
+	_, stderr, err := runWslCommand(ctx, "sudo", "-n", "true")
+
+	switch mode {
+	case sudoPasswordless:
+		require.NoErrorf(t, err, "User %q should be able to use sudo without a password", user)
+	case sudoRequiresPassword:
+		require.Errorf(t, err, "User %q should need a password to use sudo", user)
+		require.Containsf(t, stderr, "password is required", "sudo should have failed only because user %q needs a password", user)
+	}
+}
+
+// assertPasswordLogin fails if the user has no usable password in the distro targeted by ctx, or if
+// the password does not authenticate it. Authentication is checked with "sudo --stdin" run as the user,
+// so the user must be allowed to use sudo.
+// The password is never logged: it is fed through stdin and redacted from failure messages.
+func assertPasswordLogin(t *testing.T, ctx context.Context, user, password string) {
+	t.Helper()
+
+	require.NotEmpty(t, password, "Setup: the password to check cannot be empty")
+	redact := func(s string) string { return strings.ReplaceAll(s, password, "[REDACTED]") }
+
+	// Example output of passwd --status:
+	// ubuntu P 2024-01-01 0 99999 7 -1
+	status := strings.Fields(assertWslCommandAsUser(t, ctx, "root", "passwd", "--status", user))
+	require.GreaterOrEqualf(t, len(status), 2, "Could not parse the password status of user %q: %q", user, status)
+	require.Equalf(t, "P", status[1], "User %q should have a usable password (status is %q: NP means none, L means locked)", user, status[1])
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	// Going through --exec so that the empty prompt reaches sudo, and without verbose output to keep the logs clean.
+	ctx = withVerboseOutput(ctx, nil)
+	cmd := exec.CommandContext(ctx, "wsl.exe", "-d", targetDistro(ctx), "-u", user, "--exec", "sudo", "--stdin", "--reset-timestamp", "--prompt=", "true")
+	cmd.Stdin = strings.NewReader(password + "\n")
+
+	_, _, err := runCommand(ctx, cmd)
+	if err != nil {
+		require.Failf(t, "Password does not authenticate the user", "User %q could not authenticate with the expected password:\n%s", user, redact(err.Error()))
+	}
+}
+
+// assertSudoersContains fails if neither /etc/sudoers nor the files in /etc/sudoers.d in the distro
+// targeted by ctx contain substr.
+func assertSudoersContains(t *testing.T, ctx context.Context, substr string) {
+	t.Helper()
+
+	sudoers := assertWslCommandAsUser(t, ctx, "root", "sh", "-c", "cat /etc/sudoers /etc/sudoers.d/*")
+	require.Containsf(t, sudoers, substr, "sudoers configuration does not contain the expected text")
+}
+
+// copyToDistro copies the file at localPath on the Windows host into distroPath inside the distro targeted by ctx,
+// creating intermediate directories as needed. The copy is made as root, and contents are copied verbatim.
+// Fails if the file cannot be copied.
+func copyToDistro(t *testing.T, ctx context.Context, localPath, distroPath string) {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	f, err := os.Open(localPath)
+	require.NoError(t, err, "Setup: could not open file to copy into the distro")
+	defer f.Close()
+
+	_, _, err = runCommand(ctx, rootExecCommand(ctx, "mkdir", "-p", path.Dir(distroPath)))
+	require.NoErrorf(t, err, "Could not create directory for %s", distroPath)
+
+	cmd := rootExecCommand(ctx, "dd", "of="+distroPath, "status=none")
+	cmd.Stdin = f
+	_, _, err = runCommand(ctx, cmd)
+	require.NoErrorf(t, err, "Could not copy %s into %s", localPath, distroPath)
+}
+
+// copyFromDistro copies the file at distroPath inside the distro targeted by ctx into localPath on the Windows host,
+// creating intermediate directories as needed. The file is read as root, and contents are copied verbatim.
+// Fails if the file cannot be copied.
+func copyFromDistro(t *testing.T, ctx context.Context, distroPath, localPath string) {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	out, _, err := runCommand(ctx, rootExecCommand(ctx, "cat", distroPath))
+	require.NoErrorf(t, err, "Could not read %s", distroPath)
+
+	err = os.MkdirAll(filepath.Dir(localPath), 0750)
+	require.NoErrorf(t, err, "Could not create directory for %s", localPath)
+
+	err = os.WriteFile(localPath, []byte(out), 0600)
+	require.NoErrorf(t, err, "Could not write %s", localPath)
+}
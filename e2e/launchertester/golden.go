@@ -0,0 +1,58 @@
+package launchertester
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "Update the golden files under testdata/ with the current output instead of comparing against them.")
+
+// assertWslMatchesGolden runs the Linux command in the distro under test, and returns its stdout.
+// Fails if the command does not succeed, or if its stdout differs from the golden file (see assertGolden).
+func assertWslMatchesGolden(t *testing.T, ctx context.Context, goldenName string, normalize func(string) string, linuxCmd ...string) string {
+	t.Helper()
+
+	out := assertWslCommand(t, ctx, linuxCmd...)
+	assertGolden(t, goldenName, normalize, out)
+
+	return out
+}
+
+// assertGolden fails if the output differs from the contents of testdata/<goldenName>. If normalize is not nil,
+// it is applied to the output beforehand, to scrub volatile substrings such as hostnames or UIDs.
+// Both are trimmed, and carriage returns are ignored, so that checking out the golden files with
+// Windows line endings does not matter.
+// When the tests run with --update, the golden file is written with the output instead.
+func assertGolden(t *testing.T, goldenName string, normalize func(string) string, out string) {
+	t.Helper()
+
+	if normalize != nil {
+		out = normalize(out)
+	}
+	got := strings.TrimSpace(strings.ReplaceAll(out, "\r", ""))
+
+	path := filepath.Join("testdata", goldenName)
+
+	if *updateGolden {
+		err := os.MkdirAll(filepath.Dir(path), 0750)
+		require.NoErrorf(t, err, "Could not create directory for golden file %s", path)
+
+		err = os.WriteFile(path, []byte(got+"\n"), 0600)
+		require.NoErrorf(t, err, "Could not update golden file %s", path)
+
+		t.Logf("Updated golden file %s", path)
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoErrorf(t, err, "Could not read golden file %s. Run the tests with --update to create it", path)
+
+	require.Equalf(t, strings.TrimSpace(strings.ReplaceAll(string(want), "\r", "")), got,
+		"Output does not match golden file %s. Run the tests with --update to update it if the change is expected", path)
+}
@@ -0,0 +1,32 @@
+package launchertester
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestHeadlessSetup runs a battery of assertions on the default user after installing with the
+// distro launcher, answering its prompts through stdin.
+func TestHeadlessSetup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	installHeadless(t, ctx, headlessUser, headlessPassword)
+
+	testCases := map[string]func(t *testing.T){
+		"UserNotRoot":          testUserNotRoot,
+		"UserIsSudoer":         testUserIsSudoer,
+		"SudoRequiresPassword": testSudoRequiresPassword,
+		"DefaultUserNotRoot":   testDefaultUserNotRoot,
+		"DefaultUIDNotZero":    testDefaultUIDNotZero,
+		"UserHomeDirectory":    testUserHomeDirectory,
+		"UserShellIsBash":      testUserShellIsBash,
+		"PasswordLogin":        testPasswordLogin,
+		"LocaleMatchesGolden":  testLocaleMatchesGolden,
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, tc)
+	}
+}
@@ -13,8 +13,7 @@ func TestHelpFlagNoInstall(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 	defer cancel()
 
-	out, err := launcherCommand(ctx, "help").CombinedOutput()
-	require.NoErrorf(t, err, "Unexpected error using help message: %s", out)
+	assertLauncherCommand(t, ctx, "help")
 
 	require.Equal(t, "DistroNotFound", distroState(t), "Using command help should not install the distro")
 }
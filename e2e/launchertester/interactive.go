@@ -0,0 +1,163 @@
+package launchertester
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// launcherSession drives an interactive launcher process. The launcher does not flush its output when
+// it is not attached to a console, so prompts cannot be waited for: answers are written into its stdin
+// as soon as the launcher can take them, and the output is checked once it exits.
+type launcherSession struct {
+	t     *testing.T
+	stdin io.WriteCloser
+
+	// output is the combined stdout and stderr of the launcher.
+	output *lockedBuffer
+
+	// exited is closed when the launcher exits. err is only set afterwards.
+	exited chan struct{}
+	err    error
+}
+
+// interactiveLauncher starts the launcher with the specified verb and arguments, and returns a session
+// to interact with it. The launcher is started directly rather than through PowerShell, so that
+// its stdin is not relayed by another process. The launcher is killed at the end of the test if it is still running.
+// Fails if the launcher cannot be started.
+func interactiveLauncher(t *testing.T, ctx context.Context, verb string, args ...string) *launcherSession {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+
+	cmd := directLauncherCommand(ctx, verb, args...)
+	killTreeOnCancel(cmd)
+	output := &lockedBuffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		require.NoError(t, err, "Setup: could not create stdin pipe for the launcher")
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		require.NoError(t, err, "Could not start the launcher")
+	}
+
+	s := &launcherSession{
+		t:      t,
+		stdin:  stdin,
+		output: output,
+		exited: make(chan struct{}),
+	}
+
+	go func() {
+		defer cancel()
+		s.err = cmd.Wait()
+		close(s.exited)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-s.exited
+	})
+
+	return s
+}
+
+// waitFor calls done every second until it returns true.
+// Fails with the output so far if the launcher exits first, or if done does not return true before the timeout.
+func (s *launcherSession) waitFor(what string, timeout time.Duration, done func() bool) {
+	s.t.Helper()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	deadline := time.After(timeout)
+	for !done() {
+		select {
+		case <-ticker.C:
+		case <-s.exited:
+			require.Failf(s.t, "Launcher exited too early", "Waiting for: %s\nExit error: %v\nOutput so far:\n%s", what, s.err, s.output)
+		case <-deadline:
+			require.Failf(s.t, "Timed out waiting for the launcher", "Waiting for: %s\nOutput so far:\n%s", what, s.output)
+		}
+	}
+}
+
+// sendLine writes the line into the launcher's stdin, followed by a line break.
+func (s *launcherSession) sendLine(line string) {
+	s.t.Helper()
+
+	_, err := io.WriteString(s.stdin, line+"\n")
+	require.NoError(s.t, err, "Could not write into the launcher's stdin")
+}
+
+// wait closes the launcher's stdin and waits for it to exit. The returned error is an *exec.ExitError
+// if the exit code was not zero.
+func (s *launcherSession) wait() error {
+	s.t.Helper()
+
+	_ = s.stdin.Close()
+	<-s.exited
+
+	return s.err
+}
+
+// installHeadless validates the test environment, installs the distro with the launcher in text mode, creating
+// the default user by answering the launcher's prompts through stdin, and waits for the distro to boot.
+// It returns the transcript of the installation. The distro is unregistered at the end of the test.
+// Fails with the transcript if the installation does not succeed, or if any expected prompt was not printed.
+func installHeadless(t *testing.T, ctx context.Context, username, password string) string {
+	t.Helper()
+
+	wslSetup(t)
+
+	s := interactiveLauncher(t, ctx, "install")
+
+	s.sendLine(username)
+
+	// The passwords, read by passwd inside the distro, are only written once the user exists: written any
+	// earlier, they would be read into the launcher's own stdin buffer along with the username.
+	s.waitFor(fmt.Sprintf("user %q to be created", username), installTimeout, func() bool {
+		_, err := accountInfo(ctx, username)
+		return err == nil
+	})
+	s.sendLine(password)
+	s.sendLine(password)
+
+	err := s.wait()
+	out := s.output.String()
+	require.NoErrorf(t, err, "Launcher failed to install the distro. Output:\n%s", out)
+
+	assertPrintedInOrder(t, out,
+		"For more information visit: https://aka.ms/wslusers",
+		"New password:",
+		"Retype new password:",
+		"Installation successful!")
+
+	assertRegistered(t)
+	waitForBoot(t, ctx, systemdBootTimeout)
+
+	return out
+}
+
+// assertPrintedInOrder fails if the output does not contain each of the substrings, in the specified order.
+func assertPrintedInOrder(t *testing.T, out string, substrs ...string) {
+	t.Helper()
+
+	rest := out
+	for _, substr := range substrs {
+		i := strings.Index(rest, substr)
+		require.NotEqualf(t, -1, i, "Expected %q in the output, after the previous expected prompts. Output:\n%s", substr, out)
+		rest = rest[i+len(substr):]
+	}
+}
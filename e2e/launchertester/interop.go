@@ -0,0 +1,52 @@
+package launchertester
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// assertInteropEnabled fails if running a Windows executable from the distro targeted by ctx does not
+// behave as its /etc/wsl.conf says it should: it must succeed unless [interop] enabled is false.
+func assertInteropEnabled(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	conf, err := readWslConf(ctx)
+	require.NoError(t, err, "Could not find out if interop is enabled")
+
+	// Without appendWindowsPath, Windows executables are not in the PATH.
+	cmdExe := "cmd.exe"
+	if !conf.Interop.AppendWindowsPath {
+		cmdExe = path.Join(conf.Automount.Root, "c", "Windows", "System32", "cmd.exe")
+	}
+
+	stdout, _, err := runWslCommand(ctx, cmdExe, "/c", "echo", "ok")
+	if !conf.Interop.Enabled {
+		require.Error(t, err, "Windows executables should not run when interop is disabled in wsl.conf")
+		return
+	}
+	require.NoError(t, err, "Failed to launch cmd.exe from WSL. Does interop work?")
+	assertOutputEquals(t, "ok", stdout)
+}
+
+// assertDriveMounted fails if the Windows drive (such as "c") is not mounted in the distro targeted by ctx.
+// The mount directory is taken from the [automount] section of /etc/wsl.conf. If automount is
+// disabled there, the drive is instead expected not to be mounted.
+func assertDriveMounted(t *testing.T, ctx context.Context, drive string) {
+	t.Helper()
+
+	conf, err := readWslConf(ctx)
+	require.NoError(t, err, "Could not find out if drives are automounted")
+
+	mountpoint := path.Join(conf.Automount.Root, strings.ToLower(drive))
+	_, _, err = runWslCommand(ctx, "mountpoint", "-q", mountpoint)
+
+	if !conf.Automount.Enabled {
+		require.Errorf(t, err, "%s should not be mounted when automount is disabled in wsl.conf", mountpoint)
+		return
+	}
+	require.NoErrorf(t, err, "%s should be a mountpoint", mountpoint)
+}
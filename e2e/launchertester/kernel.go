@@ -0,0 +1,130 @@
+package launchertester
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// kernelVersion returns the release of the kernel running the distro targeted by ctx, as reported by "uname -r".
+// For instance: "5.15.133.1-microsoft-standard-WSL2".
+func kernelVersion(t *testing.T, ctx context.Context) string {
+	t.Helper()
+
+	return strings.TrimSpace(assertWslCommand(t, ctx, "uname", "-r"))
+}
+
+// wslComponentVersions are the versions of the components of WSL reported by "wsl --version".
+type wslComponentVersions struct {
+	wsl    string
+	kernel string
+	wslg   string
+}
+
+// wslVersion parses the output of "wsl --version" to find the versions of WSL, its kernel and WSLg.
+// Only the English output is understood. Older inbox versions of WSL do not support --version, in
+// which case an error is returned.
+func wslVersion(ctx context.Context) (wslComponentVersions, error) {
+	cmd := exec.CommandContext(ctx, "wsl.exe", "--version")
+	cmd.Env = append(os.Environ(), "WSL_UTF8=1")
+	raw, err := cmd.CombinedOutput()
+	out := decodeWslOutput(raw)
+	if err != nil {
+		return wslComponentVersions{}, fmt.Errorf("could not get WSL version: %v. Output: %s", err, out)
+	}
+
+	// Example line:
+	// Kernel version: 5.15.133.1-1
+	pattern := regexp.MustCompile(`^(WSL|Kernel|WSLg) version: (\S+)$`)
+
+	var v wslComponentVersions
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		m := pattern.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+
+		switch m[1] {
+		case "WSL":
+			v.wsl = m[2]
+		case "Kernel":
+			v.kernel = m[2]
+		case "WSLg":
+			v.wslg = m[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return wslComponentVersions{}, fmt.Errorf("unexpected error in scanner: %v", err)
+	}
+
+	if v.wsl == "" {
+		return wslComponentVersions{}, fmt.Errorf("could not find the WSL version in the output of 'wsl --version': %s", out)
+	}
+
+	return v, nil
+}
+
+// requireKernelAtLeast skips the test if the kernel running the distro targeted by ctx is older than min,
+// such as "5.15" or "5.15.90". Fails if the kernel version cannot be parsed.
+func requireKernelAtLeast(t *testing.T, ctx context.Context, min string) {
+	t.Helper()
+
+	want, err := parseVersionNumbers(min)
+	require.NoErrorf(t, err, "Setup: invalid minimum kernel version %q", min)
+
+	release := kernelVersion(t, ctx)
+	got, err := parseVersionNumbers(release)
+	require.NoErrorf(t, err, "Could not parse kernel version %q", release)
+
+	if compareVersionNumbers(got, want) < 0 {
+		t.Skipf("Skipped: kernel %s is older than %s", release, min)
+	}
+}
+
+// parseVersionNumbers returns the dot-separated numbers at the start of the version, ignoring any suffix:
+// "5.15.133.1-microsoft-standard-WSL2" is parsed as [5 15 133 1].
+func parseVersionNumbers(version string) ([]int, error) {
+	prefix := regexp.MustCompile(`^[0-9]+(\.[0-9]+)*`).FindString(version)
+	if prefix == "" {
+		return nil, fmt.Errorf("%q does not start with a version number", version)
+	}
+
+	var numbers []int
+	for _, field := range strings.Split(prefix, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %q in version %q: %v", field, version, err)
+		}
+		numbers = append(numbers, n)
+	}
+
+	return numbers, nil
+}
+
+// compareVersionNumbers returns a negative number if a is older than b, a positive one if it is newer, and 0 if
+// they are the same. Missing trailing numbers count as 0, so that "5.15" and "5.15.0" are the same.
+func compareVersionNumbers(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+
+	return 0
+}
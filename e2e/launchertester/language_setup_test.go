@@ -0,0 +1,25 @@
+package launchertester
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLanguageSetup runs a battery of assertions on the language support installed when the
+// launcher runs with LANG set to a non-default locale.
+func TestLanguageSetup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	freshInstall(t, withEnv(ctx, map[string]string{"LANG": installLang}), launcherInstallOptions{root: true})
+
+	testCases := map[string]func(t *testing.T){
+		"LanguagePackFollowsLang": testLanguagePackFollowsLang,
+		"LocaleFollowsLang":       testLocaleFollowsLang,
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, tc)
+	}
+}
@@ -0,0 +1,121 @@
+package launchertester
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// verboseLoggerKey is the context key under which the logger used to stream command output is stored.
+type verboseLoggerKey struct{}
+
+// logger is the subset of testing.TB used to stream command output.
+type logger interface {
+	Logf(format string, args ...any)
+}
+
+// withVerboseOutput returns a copy of ctx in which the output of commands is streamed line by line into
+// the logger (typically the *testing.T), prefixed with the command that produced it. The output is
+// still captured and returned as usual. A nil logger turns streaming off.
+func withVerboseOutput(ctx context.Context, l logger) context.Context {
+	return context.WithValue(ctx, verboseLoggerKey{}, l)
+}
+
+// verboseLogger returns the logger set with withVerboseOutput, or nil if output should not be streamed.
+func verboseLogger(ctx context.Context) logger {
+	l, _ := ctx.Value(verboseLoggerKey{}).(logger)
+	return l
+}
+
+// stepKey is the context key under which the label of the current assertion step is stored.
+type stepKey struct{}
+
+// withStep returns a copy of ctx labelled with an assertion step, and logs the start of the step.
+// The label is included in the streamed output and in the errors of commands run with the returned
+// context, so that failures in long tests can be traced back to the step that caused them.
+// Other assertions are not labelled: prefix their messages with stepMsg.
+// Steps nest: a step started from a labelled context is labelled "parent > name".
+func withStep(t *testing.T, ctx context.Context, name string) context.Context {
+	t.Helper()
+
+	if parent := currentStep(ctx); parent != "" {
+		name = parent + " > " + name
+	}
+	t.Logf("[step: %s]", name)
+
+	return context.WithValue(ctx, stepKey{}, name)
+}
+
+// currentStep returns the label set with withStep, or an empty string if there is none.
+func currentStep(ctx context.Context) string {
+	step, _ := ctx.Value(stepKey{}).(string)
+	return step
+}
+
+// stepMsg returns msg prefixed with the label set with withStep, if any, for use in assertion messages.
+func stepMsg(ctx context.Context, msg string) string {
+	if step := currentStep(ctx); step != "" {
+		return "[step: " + step + "] " + msg
+	}
+	return msg
+}
+
+// commandLabel returns a short description of the command, such as "wsl whoami", to prefix its output with.
+func commandLabel(cmd *exec.Cmd) string {
+	name := strings.TrimSuffix(filepath.Base(cmd.Path), ".exe")
+	args := cmd.Args[1:]
+
+	// The distro and user are not interesting: only the Linux command is.
+	if name == "wsl" {
+		if i := slices.Index(args, "--"); i >= 0 {
+			args = args[i+1:]
+		}
+	}
+
+	return strings.Join(append([]string{name}, args...), " ")
+}
+
+// lineLogger is a writer that logs every complete line written into it, with a prefix.
+type lineLogger struct {
+	logger logger
+	prefix string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write logs every line completed by p. Incomplete lines are kept until completed or flushed.
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf.Write(p)
+	for {
+		line, err := l.buf.ReadString('\n')
+		if err != nil {
+			// Incomplete line: keeping it for later.
+			l.buf.Reset()
+			l.buf.WriteString(line)
+			break
+		}
+		l.logger.Logf("%s%s", l.prefix, strings.TrimRight(line, "\r\n"))
+	}
+
+	return len(p), nil
+}
+
+// flush logs the last line, if it was incomplete.
+func (l *lineLogger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buf.Len() > 0 {
+		l.logger.Logf("%s%s", l.prefix, l.buf.String())
+		l.buf.Reset()
+	}
+}
@@ -0,0 +1,24 @@
+package launchertester
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if err := prerequisitesError(); err != nil {
+		if errors.Is(err, errNotWindows) {
+			fmt.Fprintf(os.Stderr, "Skipping end-to-end tests: %v\n", err)
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "Setup: host prerequisites are not met: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
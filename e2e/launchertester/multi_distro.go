@@ -0,0 +1,52 @@
+package launchertester
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// forDistro returns a copy of ctx in which WSL commands target the named distro instead of the parent's,
+// while keeping the rest of its settings (environment, verbose output, deadline). This lets a test hold
+// contexts for several distros and compare their state.
+// If the distro is not registered yet, the test is assumed to register it, and it is unregistered at the
+// end of the test unless -keep-distro is set. Distros that were already registered are left alone.
+func forDistro(t *testing.T, ctx context.Context, name string) context.Context {
+	t.Helper()
+
+	distros, err := listDistros()
+	require.NoError(t, err, "Setup: could not list registered distros")
+
+	if !slices.ContainsFunc(distros, func(d distroInfo) bool { return d.name == name }) {
+		unregisterOnCleanup(t, name)
+	}
+
+	return withTargetDistro(ctx, name)
+}
+
+// defaultDistro returns the name of the default distro of WSL, or an empty string if there is none.
+func defaultDistro() (string, error) {
+	distros, err := listDistros()
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range distros {
+		if d.isDefault {
+			return d.name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// assertDefaultDistro fails if the default distro of WSL is not the expected one.
+func assertDefaultDistro(t *testing.T, want string) {
+	t.Helper()
+
+	got, err := defaultDistro()
+	require.NoError(t, err, "Could not find the default distro")
+	require.Equal(t, want, got, "Unexpected default distro")
+}
@@ -0,0 +1,25 @@
+package launchertester
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestMultipleDistros runs the assertions that register copies of the distro next to it. Exporting and
+// importing the distro takes minutes, so they are kept out of TestBasicSetup.
+func TestMultipleDistros(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	freshInstall(t, ctx, launcherInstallOptions{root: true})
+
+	testCases := map[string]func(t *testing.T){
+		"SeveralDistros":       testSeveralDistros,
+		"WSLVersionConversion": testWSLVersionConversion,
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, tc)
+	}
+}
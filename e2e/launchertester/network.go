@@ -0,0 +1,80 @@
+package launchertester
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var networkProbeHost = flag.String("network-probe-host", "archive.ubuntu.com", "Host used to check that the distro has working DNS and network connectivity.")
+
+// assertNetworkWorks fails if the distro targeted by ctx cannot resolve and reach the host passed
+// with --network-probe-host over HTTP. DNS and connectivity failures are reported separately, so
+// that a broken environment is not mistaken for a launcher bug. Use it before assertions that need
+// the network, such as apt operations.
+func assertNetworkWorks(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	host := *networkProbeHost
+
+	_, _, err := runWslCommand(ctx, "getent", "hosts", host)
+	require.NoErrorf(t, err, "Environment: DNS resolution of %q failed inside the distro. Check /etc/resolv.conf and the host's network before suspecting the launcher", host)
+
+	_, _, err = runWslCommand(ctx, "curl", "--silent", "--fail", "--head", "--max-time", "30", "http://"+host+"/")
+	require.NoErrorf(t, err, "Environment: %q resolves but cannot be reached over HTTP from inside the distro. Check the host's network and proxy settings before suspecting the launcher", host)
+}
+
+// hostname returns the hostname of the distro targeted by ctx.
+func hostname(t *testing.T, ctx context.Context) string {
+	t.Helper()
+
+	return strings.TrimSpace(assertWslCommand(t, ctx, "hostname"))
+}
+
+// assertHostsContains fails if /etc/hosts in the distro targeted by ctx has no entry for the address of entry
+// with all of its names, such as "127.0.0.1 localhost". Entries may list other names too.
+func assertHostsContains(t *testing.T, ctx context.Context, entry string) {
+	t.Helper()
+
+	want := strings.Fields(entry)
+	require.NotEmptyf(t, want, "Setup: invalid hosts entry %q", entry)
+
+	hosts := readFile(t, ctx, "/etc/hosts")
+
+	scanner := bufio.NewScanner(strings.NewReader(hosts))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		got := strings.Fields(line)
+		if len(got) == 0 || got[0] != want[0] {
+			continue
+		}
+		// Matching if none of the wanted names is missing from the entry.
+		if !slices.ContainsFunc(want[1:], func(name string) bool { return !slices.Contains(got[1:], name) }) {
+			return
+		}
+	}
+	require.NoError(t, scanner.Err(), "Error scanning /etc/hosts")
+
+	require.Failf(t, "/etc/hosts does not contain the expected entry", "Entry: %s\n/etc/hosts:\n%s", entry, hosts)
+}
+
+// assertGeneratedHosts fails if /etc/hosts in the distro targeted by ctx lacks the loopback and hostname entries
+// that WSL generates. The test is skipped if generateHosts is disabled in /etc/wsl.conf, since the file is then
+// managed by the user.
+func assertGeneratedHosts(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	conf, err := readWslConf(ctx)
+	require.NoError(t, err, "Could not find out if /etc/hosts is generated")
+	if !conf.Network.GenerateHosts {
+		t.Skip("Skipped: generateHosts is disabled in wsl.conf, so /etc/hosts is managed by the user")
+	}
+
+	assertHostsContains(t, ctx, "127.0.0.1 localhost")
+	assertHostsContains(t, ctx, "127.0.1.1 "+hostname(t, ctx))
+}
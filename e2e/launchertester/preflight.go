@@ -0,0 +1,73 @@
+package launchertester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// errNotWindows is returned by checkPrerequisites when the tests are not running on a Windows host.
+var errNotWindows = errors.New("the end-to-end tests must run on a Windows host with WSL enabled")
+
+// prerequisitesError caches the result of checkPrerequisites, which does not change during a test run.
+var prerequisitesError = sync.OnceValue(checkPrerequisites)
+
+// checkPrerequisites returns an error explaining how to fix the host if WSL is not usable.
+// It does not need a *testing.T, so it can be called from TestMain, after the flags are parsed.
+// The launcher is not checked here: tests that do not need it, such as TestImportedRootfs, must still run
+// without it. See requireLauncher.
+func checkPrerequisites() error {
+	if runtime.GOOS != "windows" {
+		return errNotWindows
+	}
+
+	if _, err := exec.LookPath("wsl.exe"); err != nil {
+		return fmt.Errorf("wsl.exe not found: install WSL with 'wsl --install' from an elevated prompt: %v", err)
+	}
+
+	// A hung WSL service would otherwise block the whole test run.
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "wsl.exe", "--status")
+	killTreeOnCancel(cmd)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("'wsl --status' did not return within %s: the WSL service may be hung. "+
+			"Run 'wsl --shutdown' or restart the host: %v", commandTimeout, ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("'wsl --status' failed: the WSL feature may be missing or virtualization disabled in the BIOS. "+
+			"Run 'wsl --install' and check that 'Virtual Machine Platform' is enabled: %v\n%s", err, strings.TrimSpace(decodeWslOutput(out)))
+	}
+
+	return nil
+}
+
+// requireWSL skips the test if it is not running on Windows, and fails it right away
+// if WSL is not usable on the host.
+func requireWSL(t *testing.T) {
+	t.Helper()
+
+	err := prerequisitesError()
+	if errors.Is(err, errNotWindows) {
+		t.Skipf("Skipped: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Setup: host prerequisites are not met: %v", err)
+	}
+}
+
+// requireLauncher fails the test right away if the launcher under test cannot be found.
+func requireLauncher(t *testing.T) {
+	t.Helper()
+
+	if _, err := findLauncher(*launcherName); err != nil {
+		t.Fatalf("Setup: %v: install the appx under test, or pass --launcher-name", err)
+	}
+}
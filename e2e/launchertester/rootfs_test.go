@@ -0,0 +1,29 @@
+package launchertester
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var rootfs = flag.String("rootfs", envOrDefault("WSL_ROOTFS", ""), "Rootfs tarball to test with TestImportedRootfs, such as a nightly build. Defaults to $WSL_ROOTFS if set.")
+
+// TestImportedRootfs runs the assertions that do not need the launcher against a rootfs tarball imported with WSL.
+func TestImportedRootfs(t *testing.T) {
+	if *rootfs == "" {
+		t.Skip("Skipped: no rootfs tarball passed with --rootfs")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	ctx = importRootfs(t, ctx, uniqueDistroName(t), *rootfs, distroInstallDir(t))
+
+	require.Equal(t, "ubuntu", distroID(t, ctx), "The rootfs should be an Ubuntu one")
+	assertInteropEnabled(t, ctx)
+	assertDriveMounted(t, ctx, "c")
+	assertGeneratedHosts(t, ctx)
+}
@@ -0,0 +1,121 @@
+package launchertester
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotDistro exports the distro targeted by ctx into a tarball, and returns its path.
+// The tarball is stored in a temporary directory that is removed at the end of the test.
+func snapshotDistro(t *testing.T, ctx context.Context) string {
+	t.Helper()
+
+	distro := targetDistro(ctx)
+	path := filepath.Join(t.TempDir(), "snapshot.tar")
+
+	t.Logf("Exporting distro %q into %s", distro, path)
+	out, err := exec.CommandContext(ctx, "wsl.exe", "--export", distro, path).CombinedOutput()
+	require.NoErrorf(t, err, "Failed to export distro %q: %s", distro, decodeWslOutput(out))
+
+	return path
+}
+
+// restoreSnapshot imports the tarball under a distro name unique to the test, and returns
+// a copy of ctx in which WSL commands target the new distro. The unique name prevents
+// parallel tests from clobbering each other's instance.
+// The new distro is unregistered at the end of the test, unless -keep-distro is set.
+//
+// Note that the launcher always operates on its own distro, so launcher commands are not
+// affected by the returned context.
+func restoreSnapshot(t *testing.T, ctx context.Context, tarball string) context.Context {
+	t.Helper()
+
+	return importRootfs(t, ctx, uniqueDistroName(t), tarball, distroInstallDir(t))
+}
+
+// restoreSnapshotAsVersion is like restoreSnapshot, but registers the new distro with the specified WSL version
+// rather than with the default one of the host.
+// WSL 1 is an optional component that many hosts lack, so the test is skipped if the tarball cannot be
+// imported as a WSL 1 distro. Failing to import it with any other version fails the test.
+func restoreSnapshotAsVersion(t *testing.T, ctx context.Context, tarball string, version int) context.Context {
+	t.Helper()
+
+	name := uniqueDistroName(t)
+	installDir := distroInstallDir(t)
+
+	t.Logf("Importing %s as WSL%d distro %q", tarball, version, name)
+	out, err := exec.CommandContext(ctx, "wsl.exe", "--import", name, installDir, tarball, "--version", strconv.Itoa(version)).CombinedOutput()
+	if err != nil && version == 1 {
+		t.Skipf("Skipped: could not import a WSL1 distro on this host: %v. Output: %s", err, decodeWslOutput(out))
+	}
+	require.NoErrorf(t, err, "Failed to import %s as WSL%d distro %q: %s", tarball, version, name, decodeWslOutput(out))
+
+	// Registered after the install directory is created so that the distro is unregistered before it is removed.
+	unregisterOnCleanup(t, name)
+
+	return withTargetDistro(ctx, name)
+}
+
+// distroInstallDir returns a directory to install a new distro into. It is removed at the end of the test,
+// unless -keep-distro is set, in which case it is left behind along with the distro it holds.
+func distroInstallDir(t *testing.T) string {
+	t.Helper()
+
+	if !*keepDistro {
+		return t.TempDir()
+	}
+
+	dir, err := os.MkdirTemp("", "launchertester-")
+	require.NoError(t, err, "Setup: could not create the install directory")
+	t.Logf("Installing into %s, which will be kept after the test", dir)
+
+	return dir
+}
+
+// importRootfs registers the rootfs tarball as a new distro with "wsl --import", installing it into installDir,
+// and returns a copy of ctx in which WSL commands target the new distro. This allows running assertions
+// against a specific rootfs build rather than the one bundled with the launcher, which cannot install
+// other tarballs. The distro is unregistered at the end of the test, unless -keep-distro is set.
+// Fails if the tarball does not exist or cannot be imported.
+func importRootfs(t *testing.T, ctx context.Context, name, tarball, installDir string) context.Context {
+	t.Helper()
+
+	_, err := os.Stat(tarball)
+	require.NoErrorf(t, err, "Setup: rootfs tarball %s cannot be imported", tarball)
+
+	t.Logf("Importing %s as distro %q", tarball, name)
+	out, err := exec.CommandContext(ctx, "wsl.exe", "--import", name, installDir, tarball).CombinedOutput()
+	require.NoErrorf(t, err, "Failed to import %s as distro %q: %s", tarball, name, decodeWslOutput(out))
+
+	// Registered after the install directory is created so that the distro is unregistered before it is removed.
+	unregisterOnCleanup(t, name)
+
+	return withTargetDistro(ctx, name)
+}
+
+// isolateDistro registers a copy of the distro targeted by ctx under a name unique to the test, and returns
+// a copy of ctx in which WSL commands target that copy. This allows tests to call t.Parallel without
+// clobbering each other's instance. The copy is unregistered at the end of the test.
+func isolateDistro(t *testing.T, ctx context.Context) context.Context {
+	t.Helper()
+
+	return restoreSnapshot(t, ctx, snapshotDistro(t, ctx))
+}
+
+// uniqueDistroName returns a distro name derived from the distro under test and the name of the test,
+// with a random suffix to make it unique.
+func uniqueDistroName(t *testing.T) string {
+	t.Helper()
+
+	name := regexp.MustCompile(`[^a-zA-Z0-9._-]+`).ReplaceAllString(t.Name(), "-")
+	return fmt.Sprintf("%s-%s-%08x", *distroName, name, rand.Uint32())
+}
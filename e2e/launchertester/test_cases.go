@@ -2,10 +2,15 @@ package launchertester
 
 import (
 	"bufio"
-	"bytes"
 	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,6 +19,15 @@ import (
 	"gopkg.in/ini.v1"
 )
 
+// headlessUser and headlessPassword are the credentials TestHeadlessSetup answers the launcher's prompts with.
+const (
+	headlessUser     = "ubuntu"
+	headlessPassword = "e2e-Secret-1"
+)
+
+// installLang is the locale TestLanguageSetup sets in LANG when installing the distro.
+const installLang = "fr_FR.UTF-8"
+
 // testUserNotRoot ensures the default user is not root.
 func testUserNotRoot(t *testing.T) { //nolint: thelper, this is a test
 	t.Parallel()
@@ -21,10 +35,100 @@ func testUserNotRoot(t *testing.T) { //nolint: thelper, this is a test
 	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
 	defer cancel()
 
-	out, err := wslCommand(ctx, "whoami").CombinedOutput()
-	require.NoErrorf(t, err, "Unexpected failure executing whoami: %s", out)
+	user := currentUser(t, ctx)
+	require.NotContains(t, user, "root", "Default user should not be root.")
+
+	account, err := accountInfo(ctx, user)
+	require.NoError(t, err, "Could not find the account of the default user")
+	require.NotZero(t, account.uid, "Default user should not have the UID of root")
+	require.Equalf(t, "/home/"+user, account.home, "Default user should have its home directory in /home")
+
+	// Cross-checking that the default user is a real user we can log in as.
+	assertOutputEquals(t, user, assertWslCommandAsUser(t, ctx, user, "whoami"))
+}
+
+// testUserIsSudoer ensures the default user is a member of the sudo group.
+func testUserIsSudoer(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	user := currentUser(t, ctx)
+	assertUserExists(t, ctx, user)
+	assertUserInGroup(t, ctx, user, "sudo")
+
+	// Membership is only useful if sudoers grants the group its rights.
+	assertSudoersContains(t, ctx, "%sudo")
+}
+
+// testSudoRequiresPassword ensures the default user can use sudo once authenticated.
+func testSudoRequiresPassword(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertSudo(t, ctx, sudoRequiresPassword)
+}
+
+// testPasswordLogin ensures the default user can authenticate with the password given at installation.
+func testPasswordLogin(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertPasswordLogin(t, ctx, currentUser(t, ctx), headlessPassword)
+
+	// The password hash must only be readable by root and the shadow group.
+	assertFileMode(t, ctx, "/etc/shadow", 0o640)
+}
+
+// testDefaultUserNotRoot ensures the configured default user is not root.
+// Complements testUserNotRoot, which only checks the user commands happen to run as.
+func testDefaultUserNotRoot(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertDefaultUserIsNotRoot(t, ctx)
+}
+
+// testDefaultUIDNotZero ensures the default UID registered in WSL is not that of root.
+func testDefaultUIDNotZero(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	assertDefaultUIDNotZero(t, ctx)
+}
+
+// testUserHomeDirectory ensures the default user has a home directory with sane permissions.
+func testUserHomeDirectory(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
 
-	require.NotContains(t, string(out), "root", "Default user should not be root.")
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	home := strings.TrimSpace(assertWslCommand(t, ctx, "printenv", "HOME"))
+	assertFileExists(t, ctx, home)
+
+	mode := fileMode(t, ctx, home)
+	require.Equalf(t, os.FileMode(0o700), mode&0o700, "Owner should have full access to home directory %s, mode is %#o", home, mode)
+	require.Zerof(t, mode&0o002, "Home directory %s should not be world-writable, mode is %#o", home, mode)
+}
+
+// testUserShellIsBash ensures the default user gets bash as its login shell, rather than sh or nologin.
+func testUserShellIsBash(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertUserShell(t, ctx, currentUser(t, ctx), "/bin/bash")
 }
 
 // testSystemdEnabled ensures systemd was enabled.
@@ -34,6 +138,8 @@ func testSystemdEnabled(t *testing.T) { //nolint: thelper, this is a test
 	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
 	defer cancel()
 
+	assertWslConf(t, ctx, func(c *wslConf) bool { return c.Boot.Systemd })
+
 	out, err := wslCommand(ctx, "systemctl", "is-system-running", "--wait").CombinedOutput()
 	if err == nil {
 		return // Success: Non-deterministic
@@ -68,10 +174,9 @@ func testSystemdUnits(t *testing.T) { //nolint: thelper, this is a test
 	defer cancel()
 
 	// Reading failed units
-	out, err := wslCommand(ctx, "systemctl", "list-units", "--state=failed", "--plain", "--no-legend", "--no-pager").CombinedOutput()
-	require.NoError(t, err)
+	out := assertWslCommand(t, ctx, "systemctl", "list-units", "--state=failed", "--plain", "--no-legend", "--no-pager")
 
-	s := bufio.NewScanner(bytes.NewReader(out))
+	s := bufio.NewScanner(strings.NewReader(out))
 	var failedUnits []string
 	for s.Scan() {
 		data := strings.Fields(s.Text())
@@ -104,11 +209,10 @@ func testCorrectUpgradePolicy(t *testing.T) { //nolint: thelper, this is a test
 	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
 	defer cancel()
 
-	out, err := launcherCommand(ctx, "run", "cat", "/etc/update-manager/release-upgrades").CombinedOutput()
-	require.NoError(t, err, "Unexpected failure executing cat: %s", out)
+	out := assertLauncherRun(t, ctx, "cat", "/etc/update-manager/release-upgrades")
 	require.NotEmpty(t, out, "Release upgrades file is empty")
 
-	cfg, err := ini.Load(out)
+	cfg, err := ini.Load([]byte(out))
 	require.NoError(t, err, "Failed to parse ini file: %s", out)
 
 	section, err := cfg.GetSection("DEFAULT")
@@ -127,8 +231,7 @@ func testUpgradePolicyIdempotent(t *testing.T) { //nolint: thelper, this is a te
 	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
 	defer cancel()
 
-	wantsDate, err := launcherCommand(ctx, "run", "date", "-r", "/etc/update-manager/release-upgrades").CombinedOutput()
-	require.NoError(t, err, "Failed to execute date: %s", wantsDate)
+	wantsDate := assertLauncherRun(t, ctx, "date", "-r", "/etc/update-manager/release-upgrades")
 
 	terminateDistro(t)
 
@@ -137,10 +240,9 @@ func testUpgradePolicyIdempotent(t *testing.T) { //nolint: thelper, this is a te
 	ctx, cancel = context.WithTimeout(context.Background(), systemdBootTimeout)
 	defer cancel()
 
-	gotDate, err := launcherCommand(ctx, "run", "date", "-r", "/etc/update-manager/release-upgrades").CombinedOutput()
-	require.NoError(t, err, "Failed to execute date: %s", gotDate)
+	gotDate := assertLauncherRun(t, ctx, "date", "-r", "/etc/update-manager/release-upgrades")
 
-	require.Equal(t, string(wantsDate), string(gotDate), "Launcher is modifying release upgrade every boot")
+	require.Equal(t, wantsDate, gotDate, "Launcher is modifying release upgrade every boot")
 }
 
 // testInteropIsEnabled ensures interop works fine.
@@ -150,9 +252,536 @@ func testInteropIsEnabled(t *testing.T) { //nolint: thelper, this is a test
 	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
 	defer cancel()
 
-	got, err := wslCommand(ctx, "powershell.exe", "-noninteractive", "-nologo", "-noprofile", "-Command", `Write-Output "Hello, world!"`).CombinedOutput()
-	require.NoError(t, err, "Failed to launch powershell from WSL. Does interop work? %s", got)
-	require.Equal(t, "Hello, world!\r\n", string(got), "Unexpected output from powershell")
+	stdout, _, err := runWslCommand(ctx, "powershell.exe", "-noninteractive", "-nologo", "-noprofile", "-Command", `Write-Output "Hello, world!"`)
+	require.NoError(t, err, "Failed to launch powershell from WSL. Does interop work?")
+	require.Equal(t, "Hello, world!\r\n", stdout, "Unexpected output from powershell")
+}
+
+// testWindowsDriveIsMounted ensures the launcher leaves interop and the C: drive working after setup.
+func testWindowsDriveIsMounted(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertInteropEnabled(t, ctx)
+	assertDriveMounted(t, ctx, "c")
+}
+
+// testColdStartIsFast ensures running a command in a stopped distro does not regress in duration.
+func testColdStartIsFast(t *testing.T) { //nolint: thelper, this is a test
+	terminateDistro(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertLauncherFasterThan(t, ctx, coldStartLimit, "run", "true")
+}
+
+// testLauncherRejectsInvalidArgs ensures the launcher fails with a helpful message when given bad arguments.
+func testLauncherRejectsInvalidArgs(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// Unknown verbs print the usage.
+	assertLauncherFailsWith(t, ctx, "Usage:", "not-a-verb")
+
+	// A missing user name is rejected as an invalid argument (E_INVALIDARG).
+	assertLauncherFailsWith(t, ctx, "0x80070057", "config", "--default-user")
+}
+
+// testSetDefaultUser ensures installing with --root leaves root as the default user, and that the
+// launcher can then switch the default user to another one.
+func testSetDefaultUser(t *testing.T) { //nolint: thelper, this is a test
+	// Not parallel: changing the default user would affect other tests.
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	verifyCtx := withStep(t, ctx, "verify root is the default user")
+	require.Equal(t, "root", currentUser(t, verifyCtx), stepMsg(verifyCtx, "Installing with --root should leave root as the default user"))
+
+	const user = "e2e-default-user"
+	// The home directory must be populated from /etc/skel, not merely created.
+	assertCommandCreatesNonEmptyFile(t, withStep(t, ctx, "create user"), "/home/"+user+"/.bashrc", "useradd", "--create-home", user)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+		defer cancel()
+
+		assertLauncherSetDefaultUser(t, ctx, "root")
+		assertWslCommandAsUser(t, ctx, "root", "userdel", "--remove", user)
+	})
+
+	ctx = withStep(t, ctx, "switch default user")
+	assertLauncherSetDefaultUser(t, ctx, user)
+	require.Equal(t, user, currentUser(t, ctx), stepMsg(ctx, "The default user should have been switched"))
+	assertOutputEquals(t, user, assertLauncherRun(t, ctx, "whoami"))
+}
+
+// testResolvedIsActive ensures systemd-resolved is running, so that DNS works in systemd-enabled distros.
+func testResolvedIsActive(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertServiceActive(t, ctx, "systemd-resolved.service")
+}
+
+// testServiceCanBeStopped ensures services started in the distro can be stopped through systemd.
+func testServiceCanBeStopped(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	skipIfNoSystemd(t, ctx)
+
+	const unit = "e2e-sleep.service"
+	assertWslCommandAsUser(t, withStep(t, ctx, "start service"), "root", "systemd-run", "--unit="+unit, "sleep", "300")
+	assertServiceActive(t, ctx, unit)
+
+	assertWslCommandAsUser(t, withStep(t, ctx, "stop service"), "root", "systemctl", "stop", unit)
+	assertServiceInactive(t, ctx, unit)
+}
+
+// testWSLgIsAvailable ensures the distro is left able to run GUI applications after setup.
+func testWSLgIsAvailable(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertWSLgAvailable(t, ctx)
+}
+
+// testHostsAreGenerated ensures /etc/hosts contains the entries WSL generates.
+func testHostsAreGenerated(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertGeneratedHosts(t, ctx)
+
+	// WSL marks the file as generated, so that users know their edits will be lost.
+	assertFileContains(t, ctx, "/etc/hosts", "automatically generated by WSL")
+}
+
+// testCustomHostname ensures a hostname set in wsl.conf takes effect after a restart.
+func testCustomHostname(t *testing.T) { //nolint: thelper, this is a test
+	// Not parallel: the distro is restarted with a modified wsl.conf.
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	conf, err := readWslConf(ctx)
+	require.NoError(t, err, "Setup: could not read wsl.conf")
+	original := conf.Network.Hostname
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+		defer cancel()
+
+		conf.Network.Hostname = original
+		writeWslConf(t, ctx, conf)
+		terminateDistro(t)
+	})
+
+	const want = "e2e-hostname"
+	conf.Network.Hostname = want
+	writeWslConf(t, ctx, conf)
+	terminateDistro(t)
+
+	require.Equal(t, want, hostname(t, ctx), "Hostname set in wsl.conf should have taken effect after restart")
+	assertGeneratedHosts(t, ctx)
+}
+
+// testFilesPersistAcrossShutdown ensures files written in the distro are still there after the WSL VM shuts down.
+func testFilesPersistAcrossShutdown(t *testing.T) { //nolint: thelper, this is a test
+	// Not parallel: shutting WSL down stops every distro.
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	const path = "/var/tmp/e2e-persistence"
+	assertWslCommandAsUser(t, withStep(t, ctx, "write file"), "root", "sh", "-c", "echo persisted > "+path)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+		defer cancel()
+
+		assertWslCommandAsUser(t, ctx, "root", "rm", "-f", path)
+	})
+
+	shutdownWSL(t)
+
+	assertFileEquals(t, ctx, path, "persisted")
+}
+
+// testEnvironmentIsSet ensures interactive shells get the environment WSL is expected to provide.
+func testEnvironmentIsSet(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	require.Equal(t, targetDistro(ctx), envVar(t, ctx, "WSL_DISTRO_NAME"), "WSL_DISTRO_NAME should be the name of the distro")
+
+	conf, err := readWslConf(ctx)
+	require.NoError(t, err, "Could not read wsl.conf")
+	if conf.Interop.Enabled && conf.Interop.AppendWindowsPath {
+		assertEnvVarContains(t, ctx, "PATH", path.Join(conf.Automount.Root, "c"))
+
+		// Profile scripts, only read by login shells, must not drop the Windows entries either.
+		loginPath := assertWslLoginCommand(t, ctx, "printenv", "PATH")
+		require.Contains(t, loginPath, path.Join(conf.Automount.Root, "c"), "PATH in login shells should contain the Windows PATH")
+	}
+
+	// Variables injected from the host are forwarded, and later injections override earlier ones.
+	envCtx := withEnv(ctx, map[string]string{"LAUNCHERTESTER_FIRST": "first value"})
+	envCtx = withEnv(envCtx, map[string]string{"LAUNCHERTESTER_SECOND": "second value"})
+	assertWslOutputLines(t, envCtx, []string{"first value", "second value"}, "printenv", "LAUNCHERTESTER_FIRST", "LAUNCHERTESTER_SECOND")
+	assertWslOutput(t, withEnv(envCtx, map[string]string{"LAUNCHERTESTER_FIRST": "overridden"}), "overridden", "printenv", "LAUNCHERTESTER_FIRST")
+}
+
+// testLocaleMatchesGolden ensures the locale settings of the distro are the ones it ships with.
+func testLocaleMatchesGolden(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertWslMatchesGolden(t, ctx, "locale", nil, "locale")
+}
+
+// testLanguagePackFollowsLang ensures the language pack matching the LANG the distro was installed with is installed.
+func testLanguagePackFollowsLang(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	lang, _, _ := strings.Cut(installLang, "_")
+	pkg := "language-pack-" + lang
+	t.Logf("Found %s version %s", pkg, packageVersion(t, ctx, pkg))
+}
+
+// testLocaleFollowsLang ensures the LANG the distro was installed with is generated and set as the default locale.
+func testLocaleFollowsLang(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	assertLocale(t, ctx, installLang)
+}
+
+// testInstallIsIdempotent ensures installing the distro a second time does not alter it.
+func testInstallIsIdempotent(t *testing.T) { //nolint: thelper, this is a test
+	// Not parallel: the launcher would compete with other tests over the distro.
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	assertInstallIdempotent(t, ctx, launcherInstallOptions{root: true})
+}
+
+// testUnregisterCleansUp ensures unregistering a copy of the distro leaves nothing behind.
+func testUnregisterCleansUp(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	assertFullyUnregistered(t, isolateDistro(t, ctx))
+}
+
+// testWSLVersionConversion ensures a copy of the distro registered with WSL 1 still works once converted
+// to WSL 2, and back. The test is skipped if the host cannot register WSL 1 distros.
+func testWSLVersionConversion(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	ctx = restoreSnapshotAsVersion(t, ctx, snapshotDistro(t, ctx), 1)
+	assertDistroVersion(t, ctx, 1)
+
+	for _, version := range []int{2, 1} {
+		setDistroVersion(t, ctx, version)
+		assertDistroVersion(t, ctx, version)
+		require.Equalf(t, "ubuntu", distroID(t, ctx), "The distro should still work after converting it to WSL%d", version)
+	}
+}
+
+// testCopyFilesRoundTrip ensures files copied into the distro and back are left untouched, including line endings.
+func testCopyFilesRoundTrip(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	// CRLF line endings, a quote, a space and no trailing newline: anything a text conversion would alter.
+	want := []byte("first line\r\nsecond 'line'\r\nno newline")
+
+	src := filepath.Join(t.TempDir(), "src.txt")
+	err := os.WriteFile(src, want, 0600)
+	require.NoError(t, err, "Setup: could not write the file to copy")
+
+	distroPath := "/tmp/e2e copy/file.txt"
+	t.Cleanup(func() {
+		if _, _, err := runRootExec(context.Background(), "rm", "-rf", path.Dir(distroPath)); err != nil {
+			t.Logf("Failed to remove %s: %v", path.Dir(distroPath), err)
+		}
+	})
+
+	copyToDistro(t, ctx, src, distroPath)
+	assertFileEquals(t, ctx, distroPath, string(want))
+
+	dst := filepath.Join(t.TempDir(), "dst.txt")
+	copyFromDistro(t, ctx, distroPath, dst)
+
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err, "Could not read the file copied back from the distro")
+	require.Equal(t, want, got, "The file should be unchanged after a round trip through the distro")
+}
+
+// testKernelIsWSL2 ensures the distro runs on the kernel shipped with WSL 2, with its virtual disk as the root filesystem.
+func testKernelIsWSL2(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	// Older kernels are either WSL 1's emulation (4.4.0-<build>-Microsoft) or WSL 2 kernels
+	// predating the current naming scheme (4.19.x-microsoft-standard).
+	requireKernelAtLeast(t, ctx, "5.10")
+	require.Contains(t, kernelVersion(t, ctx), "-microsoft-standard-WSL2", "The distro should run on the WSL 2 kernel")
+
+	var mounts struct {
+		Filesystems []struct {
+			Target string `json:"target"`
+			FSType string `json:"fstype"`
+		} `json:"filesystems"`
+	}
+	assertWslJSON(t, ctx, &mounts, "findmnt", "--json", "--output", "TARGET,FSTYPE", "--mountpoint", "/")
+	require.Len(t, mounts.Filesystems, 1, "findmnt should report a single root filesystem")
+	require.Equal(t, "ext4", mounts.Filesystems[0].FSType, "The root filesystem should be the ext4 virtual disk")
+}
+
+// testSeveralDistros ensures commands can target several distros from one test, that registering them
+// does not change the default distro, and that all of them are unregistered when the test ends.
+func testSeveralDistros(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	tarball := snapshotDistro(t, ctx)
+	wantDefault, err := defaultDistro()
+	require.NoError(t, err, "Setup: could not find the default distro")
+
+	var names []string
+	t.Run("Register", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			name := uniqueDistroName(t)
+			names = append(names, name)
+
+			// Created before forDistro registers its cleanup, so that the distro is unregistered before it is removed.
+			installDir := t.TempDir()
+			distroCtx := forDistro(t, ctx, name)
+
+			out, err := exec.CommandContext(ctx, "wsl.exe", "--import", name, installDir, tarball).CombinedOutput()
+			require.NoErrorf(t, err, "Setup: failed to import distro %q: %s", name, decodeWslOutput(out))
+
+			require.Equal(t, name, envVar(t, distroCtx, "WSL_DISTRO_NAME"), "Commands should run in the distro the context targets")
+		}
+
+		assertDefaultDistro(t, wantDefault)
+	})
+
+	distros, err := listDistros()
+	require.NoError(t, err, "Could not list registered distros")
+	for _, d := range distros {
+		require.NotContainsf(t, names, d.name, "Distro %q should have been unregistered at the end of the subtest", d.name)
+	}
+}
+
+// testStdinIsForwarded ensures input fed to WSL and launcher commands reaches the Linux command whole,
+// and that it receives EOF once the input is consumed.
+func testStdinIsForwarded(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// cat would block forever without EOF, failing on the timeout.
+	const payload = "first line\nsecond line with 'quotes' and spaces\n"
+
+	require.Equal(t, payload, assertWslCommandStdin(t, ctx, payload, "cat"), "WSL command should have echoed its stdin")
+	require.Equal(t, payload, assertLauncherCommandStdin(t, ctx, payload, "run", "cat"), "Launcher command should have echoed its stdin")
+}
+
+// testCommandsRunInDir ensures commands can be run from a given directory, given either as a Linux path
+// or as a Windows path that WSL translates.
+func testCommandsRunInDir(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	assertOutputEquals(t, "/tmp", assertWslCommandInDir(t, ctx, "/tmp", "pwd"))
+
+	conf, err := readWslConf(ctx)
+	require.NoError(t, err, "Could not read wsl.conf")
+	if !conf.Automount.Enabled {
+		return // Windows paths cannot be translated without the drives mounted
+	}
+
+	// A space checks that the directory reaches WSL as a single argument.
+	winDir := filepath.Join(t.TempDir(), "with space")
+	err = os.Mkdir(winDir, 0750)
+	require.NoError(t, err, "Setup: could not create the Windows directory")
+
+	want, _, err := runRootExec(ctx, "wslpath", "-u", winDir)
+	require.NoErrorf(t, err, "Could not translate %s into a Linux path", winDir)
+	assertOutputEquals(t, want, assertWslCommandInDir(t, ctx, winDir, "pwd"))
+}
+
+// testDiskIsCreated ensures installing the distro leaves its disk in the install directory on the Windows host.
+func testDiskIsCreated(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	_, basePath, err := registryEntry(ctx)
+	require.NoError(t, err, "Could not find where the distro is installed")
+
+	distros, err := listDistros()
+	require.NoError(t, err, "Could not list registered distros")
+	i := slices.IndexFunc(distros, func(d distroInfo) bool { return d.name == targetDistro(ctx) })
+	require.NotEqual(t, -1, i, "The distro should be registered")
+
+	disk := "ext4.vhdx"
+	if distros[i].version == 1 {
+		disk = "rootfs"
+	}
+	assertFileExistsWindows(t, filepath.Join(basePath, disk))
+}
+
+// testCancelStopsCommands ensures cancelling a context shared by several commands stops all of them,
+// and that their errors report a cancellation rather than a timeout.
+func testCancelStopsCommands(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	ctx, cancelShared := context.WithCancel(ctx)
+	defer cancelShared()
+
+	const workers = 2
+	errs := make([]error, workers)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = runWslCommand(ctx, "sleep", "60")
+		}(i)
+	}
+
+	time.Sleep(5 * time.Second)
+	cancelShared()
+	wg.Wait()
+
+	require.Less(t, time.Since(start), 30*time.Second, "Cancelling the context should have stopped the commands")
+	for i := 0; i < workers; i++ {
+		require.ErrorIsf(t, errs[i], context.Canceled, "Worker %d should report a cancellation", i)
+		require.NotErrorIsf(t, errs[i], context.DeadlineExceeded, "Worker %d should not report a timeout", i)
+	}
+}
+
+// testNetworkWorks ensures the distro has working DNS and network connectivity after setup.
+func testNetworkWorks(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	// The resolver can take a few seconds to come up after boot: waiting for it, so that
+	// a slow start is not reported as broken DNS.
+	assertWslCommandEventually(t, ctx, commandTimeout, "getent", "hosts", *networkProbeHost)
+	assertNetworkWorks(t, ctx)
+}
+
+// testAptIsConfigured ensures the launcher leaves a working apt configuration, pointing at the Ubuntu archive.
+func testAptIsConfigured(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	sources := aptSources(t, ctx)
+	require.NotEmpty(t, sources, "No apt sources are enabled")
+
+	var archive bool
+	for _, s := range sources {
+		if strings.Contains(s, "ubuntu.com/ubuntu") {
+			archive = true
+			break
+		}
+	}
+	require.Truef(t, archive, "apt sources should point at the Ubuntu archive. Sources:\n%s", strings.Join(sources, "\n"))
+
+	assertAptUpdateSucceeds(t, ctx)
+}
+
+// testDistroIsUbuntu ensures the distro identifies itself as Ubuntu.
+func testDistroIsUbuntu(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	require.Equal(t, "ubuntu", distroID(t, ctx), "Unexpected distro ID in /etc/os-release")
+	require.NotEmpty(t, versionCodename(t, ctx), "Version codename should be set in /etc/os-release")
+
+	// Ubuntu releases are numbered YY.MM. Checked through both WSL and the launcher's run verb.
+	const versionID = `(?m)^VERSION_ID="[0-9]{2}\.[0-9]{2}"$`
+	assertWslOutputMatches(t, ctx, versionID, "cat", "/etc/os-release")
+	assertLauncherOutputMatches(t, ctx, versionID, "run", "cat", "/etc/os-release")
+}
+
+// testExitCodeIsForwarded ensures the exit code of Linux commands reaches the Windows side.
+func testExitCodeIsForwarded(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+
+	runCases(t, ctx, []wslCase{
+		{name: "Success", args: []string{"true"}, wantExit: 0},
+		{name: "Failure", args: []string{"false"}, wantExit: 1},
+		{name: "CommandNotFound", args: []string{"bash", "-c", "this-command-does-not-exist"}, wantExit: 127},
+		{name: "SuccessAsRoot", args: []string{"whoami"}, asUser: "root", wantExit: 0, wantOutContains: "root"},
+	})
+
+	// Codes other than 0 and 1 are forwarded as is, not just as success or failure.
+	assertWslExitCode(t, ctx, 42, "exit", "42")
+
+	assertLauncherExitCode(t, ctx, 0, "run", "true")
+	assertLauncherExitCode(t, ctx, 1, "run", "false")
+}
+
+// testConcurrentCommands ensures commands can be run concurrently against the same distro.
+// Run with -race to also check the helpers themselves.
+func testConcurrentCommands(t *testing.T) { //nolint: thelper, this is a test
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdBootTimeout)
+	defer cancel()
+	ctx = withEnv(ctx, map[string]string{"LAUNCHERTESTER_SHARED": "shared"})
+
+	const workers = 8
+	outputs := make([]string, workers)
+	errs := make([]error, workers)
+
+	// Assertions must not be made from goroutines other than the test's, so only non-fatal helpers are used here.
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outputs[i], _, errs[i] = runWslCommand(ctx, "echo", fmt.Sprintf("worker-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < workers; i++ {
+		require.NoErrorf(t, errs[i], "Worker %d failed", i)
+		require.Equalf(t, fmt.Sprintf("worker-%d\n", i), outputs[i], "Worker %d got an unexpected output", i)
+	}
 }
 
 func testHelpFlag(t *testing.T) {
@@ -163,15 +792,12 @@ func testHelpFlag(t *testing.T) {
 	// The usage message is not localized so it's safe to assert on it.
 	const usageFirstLine = "Launches or configures a Linux distribution."
 
-	out, err := launcherCommand(ctx, "run", "help").CombinedOutput()
-	require.NoError(t, err, "could not run '%s run help': %v, %s", *launcherName, err, out)
-	require.NotContains(t, string(out), usageFirstLine, "help command should not have been picked up by the launcher")
+	out := assertLauncherRun(t, ctx, "help")
+	require.NotContains(t, out, usageFirstLine, "help command should not have been picked up by the launcher")
 
-	out, err = launcherCommand(ctx, "-c", "help").CombinedOutput()
-	require.NoError(t, err, "could not run '%s -c help': %v, %s", *launcherName, err, out)
-	require.NotContains(t, string(out), usageFirstLine, "help command should not have been picked up by the launcher")
+	out = assertLauncherCommand(t, ctx, "-c", "help")
+	require.NotContains(t, out, usageFirstLine, "help command should not have been picked up by the launcher")
 
-	out, err = launcherCommand(ctx, "help").CombinedOutput()
-	require.NoError(t, err, "could not run '%s help': %v, %s", *launcherName, err, out)
-	require.Contains(t, string(out), usageFirstLine, "help command should have been picked up by the launcher")
+	out = assertLauncherCommand(t, ctx, "help")
+	require.Contains(t, out, usageFirstLine, "help command should have been picked up by the launcher")
 }
@@ -4,13 +4,26 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf16"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,44 +39,758 @@ const (
 	installTimeout     = 10 * time.Minute // Timeout to use for registering a new distro
 	systemdBootTimeout = 2 * time.Minute  // Timeout to use for booting up a distro using systemd
 	commandTimeout     = 10 * time.Second // Timeout to use for "instantaneous" commands such as "echo" or "exit"
+
+	defaultTimeout = 5 * time.Minute // Timeout to use for commands run with a context without deadline
+
+	aptUpdateTimeout = 5 * time.Minute // Timeout to use for running "apt-get update", including retries
+
+	coldStartLimit = 15 * time.Second // Longest acceptable time for running a command in a stopped distro
 )
 
-var launcherName = flag.String("launcher-name", DefaultLauncherName, "WSL distro launcher under test.")
-var distroName = flag.String("distro-name", DefaultDistroName, "WSL distro instance registered for testing.")
+var launcherName = flag.String("launcher-name", envOrDefault("WSL_LAUNCHER", DefaultLauncherName), "WSL distro launcher under test: either a path or an executable in the PATH. Defaults to $WSL_LAUNCHER if set.")
+var distroName = flag.String("distro-name", envOrDefault("WSL_DISTRO_NAME", DefaultDistroName), "WSL distro instance registered for testing. Defaults to $WSL_DISTRO_NAME if set.")
+var keepDistro = flag.Bool("keep-distro", false, "Do not unregister the distro at the end of each test. Useful to debug failures.")
+
+// freshInstall validates the test environment, installs the distro with the launcher and waits for it to boot,
+// and returns the output of the installation. The distro is unregistered at the end of the test.
+func freshInstall(t *testing.T, ctx context.Context, opts launcherInstallOptions) string {
+	t.Helper()
+
+	wslSetup(t)
+
+	out := assertLauncherInstall(t, withVerboseOutput(withStep(t, ctx, "install"), t), opts)
+	assertLineMatches(t, `^Installation successful!$`, out)
+	assertRegistered(t)
+	waitForBoot(t, ctx, systemdBootTimeout)
+
+	return out
+}
+
+// envOrDefault returns the value of the environment variable, or the default value if it is not set.
+func envOrDefault(name, defaultValue string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return defaultValue
+}
 
 // wslSetup validates the test environment and ensures the distro is unregistered at the end.
+// Since the distro is required not to be registered beforehand, only distros registered by
+// the test itself are unregistered.
 func wslSetup(t *testing.T) {
 	t.Helper()
 
+	requireWSL(t)
+	requireLauncher(t)
 	checkValidTestbed(t)
 
 	t.Cleanup(func() {
+		if *keepDistro {
+			t.Logf("Keeping distro %q registered after test as requested", *distroName)
+			return
+		}
+
 		if err := exec.Command("wsl.exe", "--shutdown").Run(); err != nil {
 			t.Logf("Failed to shut distro down after test: %v", err)
 		}
 
-		if err := exec.Command("wsl.exe", "--unregister", *distroName).Run(); err != nil {
-			t.Logf("Failed to unregister distro after test: %v", err)
-		}
+		unregisterIfPresent(t, *distroName)
+
+		// Fail here rather than in the next test, which requires the distro not to be registered.
+		assertNotRegistered(t)
 	})
+
+	// Registered last so that it runs first, while the distro is still registered.
+	t.Cleanup(func() { collectDiagnostics(t) })
+}
+
+// targetDistroKey is the context key under which the distro targeted by WSL commands is stored.
+type targetDistroKey struct{}
+
+// withTargetDistro returns a copy of ctx in which WSL commands target the specified distro
+// instead of the distro under test.
+func withTargetDistro(ctx context.Context, distro string) context.Context {
+	return context.WithValue(ctx, targetDistroKey{}, distro)
+}
+
+// targetDistro returns the distro targeted by WSL commands run with ctx.
+// It defaults to the distro under test.
+func targetDistro(ctx context.Context) string {
+	if distro, ok := ctx.Value(targetDistroKey{}).(string); ok {
+		return distro
+	}
+	return *distroName
+}
+
+// commandEnvKey is the context key under which the environment variables injected into commands are stored.
+type commandEnvKey struct{}
+
+// withEnv returns a copy of ctx in which commands run with the specified environment variables
+// on top of the environment of the test process. Variables set by later calls override the ones
+// set by earlier calls. The variables are also listed in WSLENV, so that they are forwarded into the distro.
+func withEnv(ctx context.Context, env map[string]string) context.Context {
+	merged := maps.Clone(commandEnv(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(env))
+	}
+	maps.Copy(merged, env)
+
+	return context.WithValue(ctx, commandEnvKey{}, merged)
+}
+
+// commandEnv returns the environment variables injected into commands run with ctx.
+func commandEnv(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(commandEnvKey{}).(map[string]string)
+	return env
 }
 
 // wslCommand mocks exec.CommandContext with WSL commands.
 func wslCommand(ctx context.Context, linuxCmd ...string) *exec.Cmd {
-	args := append([]string{"-d", *distroName, "--"}, linuxCmd...)
+	args := append([]string{"-d", targetDistro(ctx), "--"}, linuxCmd...)
 	return exec.CommandContext(ctx, "wsl.exe", args...)
 }
 
 // wslCommandAsUser mocks exec.CommandContext with WSL commands, executed as the specified user.
 func wslCommandAsUser(ctx context.Context, user string, linuxCmd ...string) *exec.Cmd {
-	args := append([]string{"-d", *distroName, "-u", user, "--"}, linuxCmd...)
+	args := append([]string{"-d", targetDistro(ctx), "-u", user, "--"}, linuxCmd...)
+	return exec.CommandContext(ctx, "wsl.exe", args...)
+}
+
+// wslCommandInDir mocks exec.CommandContext with WSL commands, executed from the specified directory.
+// The directory is a Linux path, or a Windows path to be translated by WSL.
+func wslCommandInDir(ctx context.Context, dir string, linuxCmd ...string) *exec.Cmd {
+	args := append([]string{"-d", targetDistro(ctx), "--cd", dir, "--"}, linuxCmd...)
 	return exec.CommandContext(ctx, "wsl.exe", args...)
 }
 
+// rootExecCommand mocks exec.CommandContext with WSL commands executed as root.
+// Unlike wslCommand, the command is run without going through a shell, so its arguments are passed verbatim.
+func rootExecCommand(ctx context.Context, linuxCmd ...string) *exec.Cmd {
+	args := append([]string{"-d", targetDistro(ctx), "-u", "root", "--exec"}, linuxCmd...)
+	return exec.CommandContext(ctx, "wsl.exe", args...)
+}
+
+// wslLoginCommand mocks exec.CommandContext with WSL commands run by bash as a login shell ("bash -lc"),
+// which reads /etc/profile and ~/.profile before running the command. The arguments are quoted, so they
+// reach the command verbatim.
+func wslLoginCommand(ctx context.Context, linuxCmd ...string) *exec.Cmd {
+	quoted := make([]string, len(linuxCmd))
+	for i := range linuxCmd {
+		quoted[i] = shellQuote(linuxCmd[i])
+	}
+
+	args := []string{"-d", targetDistro(ctx), "--exec", "bash", "-lc", strings.Join(quoted, " ")}
+	return exec.CommandContext(ctx, "wsl.exe", args...)
+}
+
+// shellQuote returns s as a single-quoted POSIX shell word, so that it is not subject to
+// whitespace splitting nor expansions.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // launcherCommand mocks exec.CommandContext with Launcher commands.
+// Arguments with spaces reach the launcher as a single argument. Empty arguments and arguments
+// containing double quotes are rejected: PowerShell 5.1 drops the former and does not escape the
+// latter when starting native programs, so they would not reach the launcher as given.
+// The exit code of the launcher is forwarded as the exit code of the PowerShell process.
 func launcherCommand(ctx context.Context, verb string, args ...string) *exec.Cmd {
 	args = append([]string{*launcherName, verb}, args...)
-	return exec.CommandContext(ctx, "powershell.exe", "-noninteractive", "-nologo", "-noprofile", "-command", strings.Join(args, " "))
+
+	var argErr error
+	for i := range args {
+		if args[i] == "" || strings.Contains(args[i], `"`) {
+			argErr = fmt.Errorf("launcher argument %q cannot be passed through PowerShell", args[i])
+		}
+		args[i] = powershellQuote(args[i])
+	}
+	script := "& " + strings.Join(args, " ") + " ; exit $LASTEXITCODE"
+	cmd := exec.CommandContext(ctx, "powershell.exe", "-noninteractive", "-nologo", "-noprofile", "-command", script)
+
+	// Failing early with a clear message, rather than with whatever PowerShell has to say.
+	if _, err := findLauncher(*launcherName); err != nil {
+		cmd.Err = err
+	} else if argErr != nil {
+		cmd.Err = argErr
+	}
+
+	return cmd
+}
+
+// findLauncher returns the path of the launcher, given either as a path or as an executable in the PATH.
+// It returns an error if the launcher cannot be found.
+// We don't use exec.LookPath because the launchers installed from the store are app execution aliases:
+// reparse points that os.Stat cannot follow.
+func findLauncher(name string) (string, error) {
+	if filepath.Base(name) != name {
+		if _, err := os.Lstat(name); err != nil {
+			return "", fmt.Errorf("launcher %q not found: %v", name, err)
+		}
+		return name, nil
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		path := filepath.Join(dir, name)
+		if _, err := os.Lstat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("launcher %q not found in the PATH", name)
+}
+
+// directLauncherCommand mocks exec.CommandContext with Launcher commands started directly, without the
+// PowerShell wrapper of launcherCommand. Use it for commands that read stdin: the launcher then reads the
+// test's input itself, rather than whatever PowerShell relays of it.
+func directLauncherCommand(ctx context.Context, verb string, args ...string) *exec.Cmd {
+	path, findErr := findLauncher(*launcherName)
+
+	cmd := exec.CommandContext(ctx, path, append([]string{verb}, args...)...)
+	// exec.Command's own lookup fails on app execution aliases, even though they can be started:
+	// only keeping the error of findLauncher.
+	cmd.Err = findErr
+
+	return cmd
+}
+
+// powershellCommand mocks exec.CommandContext with PowerShell scripts.
+// The script is passed encoded, so that multi-line scripts and quotes reach PowerShell unaltered.
+func powershellCommand(ctx context.Context, script string) *exec.Cmd {
+	u16 := utf16.Encode([]rune(script))
+	b := make([]byte, 2*len(u16))
+	for i, c := range u16 {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+
+	return exec.CommandContext(ctx, "powershell.exe", "-noninteractive", "-nologo", "-noprofile", "-encodedcommand", base64.StdEncoding.EncodeToString(b))
+}
+
+// powershellQuote returns s as a single-quoted PowerShell string literal, so that it is not subject to
+// whitespace splitting nor variable expansion.
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// launcherInstallOptions are the options of the launcher's install verb.
+type launcherInstallOptions struct {
+	// root skips the creation of a user account, leaving root as the default user.
+	root bool
+}
+
+// args returns the arguments to pass to the launcher's install verb.
+func (o launcherInstallOptions) args() []string {
+	var args []string
+	if o.root {
+		args = append(args, "--root")
+	}
+	return args
+}
+
+// withDefaultTimeout returns a context with a deadline of defaultTimeout, unless
+// the parent context already has a deadline, in which case it is left untouched.
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, defaultTimeout)
+}
+
+// killTreeOnCancel makes cmd kill its whole process tree when its context is done, rather than only
+// the direct child: grandchildren such as the launcher behind powershell.exe would otherwise keep the
+// output pipes open and make cmd.Wait block. Pipes still open 10 seconds after that are closed anyway.
+func killTreeOnCancel(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		if err := exec.Command("taskkill.exe", "/F", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = 10 * time.Second
+}
+
+// runCommand runs the command, capturing its stdout and stderr separately, and returns them.
+// The command must have been created with ctx. When ctx is done, the whole process tree
+// is killed (commands spawned via PowerShell would otherwise outlive it) and the returned
+// error states whether the command timed out or was cancelled. It wraps ctx.Err(), so the
+// two cases can be told apart with errors.Is(err, context.DeadlineExceeded) and
+// errors.Is(err, context.Canceled). Cancelling a context shared by several commands stops
+// all of them at once.
+// Environment variables injected into ctx with withEnv are applied, and the output is
+// streamed into the logger set with withVerboseOutput, if any.
+// The returned error is a *commandError describing the command line, exit code, duration,
+// assertion step (see withStep) and last lines of output. It wraps the underlying
+// *exec.ExitError, so the exit code can be inspected with errors.As.
+func runCommand(ctx context.Context, cmd *exec.Cmd) (stdout, stderr string, err error) {
+	var outBuf, errBuf bytes.Buffer
+	var combined lockedBuffer
+	cmd.Stdout = io.MultiWriter(&outBuf, &combined)
+	cmd.Stderr = io.MultiWriter(&errBuf, &combined)
+
+	if l := verboseLogger(ctx); l != nil {
+		var stepPrefix string
+		if step := currentStep(ctx); step != "" {
+			stepPrefix = "[step: " + step + "] "
+		}
+		label := commandLabel(cmd)
+		outLog := &lineLogger{logger: l, prefix: stepPrefix + "[" + label + "] "}
+		errLog := &lineLogger{logger: l, prefix: stepPrefix + "[" + label + " (stderr)] "}
+		defer outLog.flush()
+		defer errLog.flush()
+
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, outLog)
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, errLog)
+	}
+
+	killTreeOnCancel(cmd)
+
+	if env := commandEnv(ctx); len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		wslenv := []string{os.Getenv("WSLENV")}
+		cmd.Env = os.Environ()
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, env[k]))
+			wslenv = append(wslenv, k)
+		}
+		cmd.Env = append(cmd.Env, "WSLENV="+strings.Trim(strings.Join(wslenv, ":"), ":"))
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start)
+
+	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("timed out after %s: %w (%w)", elapsed.Round(time.Second), ctx.Err(), err)
+		case errors.Is(ctx.Err(), context.Canceled):
+			err = fmt.Errorf("cancelled after %s: %w (%w)", elapsed.Round(time.Second), ctx.Err(), err)
+		}
+
+		return outBuf.String(), errBuf.String(), &commandError{
+			commandResult: commandResult{
+				cmdLine:  cmd.String(),
+				exitCode: exitCode(err),
+				elapsed:  elapsed,
+				step:     currentStep(ctx),
+				output:   combined.String(),
+			},
+			err: err,
+		}
+	}
+
+	return outBuf.String(), errBuf.String(), nil
+}
+
+// runWslCommand runs the Linux command in the distro under test, and returns its stdout and stderr.
+// Unlike assertWslCommand, it does not fail the test, so it can be used from goroutines other than the test's.
+// If ctx has no deadline, defaultTimeout is applied.
+func runWslCommand(ctx context.Context, linuxCmd ...string) (stdout, stderr string, err error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	return runCommand(ctx, wslCommand(ctx, linuxCmd...))
+}
+
+// runWslCommandAsUser runs the Linux command in the distro under test as the specified user,
+// and returns its stdout and stderr. Unlike assertWslCommandAsUser, it does not fail the test.
+// If ctx has no deadline, defaultTimeout is applied.
+func runWslCommandAsUser(ctx context.Context, user string, linuxCmd ...string) (stdout, stderr string, err error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	return runCommand(ctx, wslCommandAsUser(ctx, user, linuxCmd...))
+}
+
+// runRootExec runs the Linux command as root in the distro under test without going through a shell, so that
+// arguments such as paths reach it verbatim, and returns its stdout and stderr. It does not fail the test.
+// If ctx has no deadline, defaultTimeout is applied.
+func runRootExec(ctx context.Context, linuxCmd ...string) (stdout, stderr string, err error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	return runCommand(ctx, rootExecCommand(ctx, linuxCmd...))
+}
+
+// assertWslCommand runs the Linux command in the distro under test, and returns its stdout.
+// Fails if the command could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertWslCommand(t *testing.T, ctx context.Context, linuxCmd ...string) string {
+	t.Helper()
+
+	stdout, _, err := runWslCommand(ctx, linuxCmd...)
+	require.NoError(t, err, "Unexpected error running WSL command")
+
+	return stdout
+}
+
+// assertWslCommandEventually runs the Linux command in the distro under test until it succeeds, and returns its stdout.
+// Failed attempts are retried with exponential backoff. Use it only for idempotent commands that may fail
+// transiently, such as those depending on the network.
+// Fails if the command has not succeeded before the timeout.
+func assertWslCommandEventually(t *testing.T, ctx context.Context, timeout time.Duration, linuxCmd ...string) string {
+	t.Helper()
+
+	return retryWslCommand(t, ctx, timeout, linuxCmd, func(ctx context.Context) (string, string, error) {
+		return runWslCommand(ctx, linuxCmd...)
+	})
+}
+
+// retryWslCommand calls run until it succeeds, with exponential backoff, and returns the stdout of the successful attempt.
+// linuxCmd is only used in messages. Fails if run has not succeeded before the timeout.
+func retryWslCommand(t *testing.T, ctx context.Context, timeout time.Duration, linuxCmd []string, run func(context.Context) (stdout, stderr string, err error)) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+
+	for attempt := 1; ; attempt++ {
+		stdout, _, err := run(ctx)
+		if err == nil {
+			return stdout
+		}
+
+		select {
+		case <-ctx.Done():
+			require.Failf(t, "WSL command did not succeed in time", "Command %q failed after %d attempts over %s.\nLast error: %v",
+				linuxCmd, attempt, timeout, err)
+		default:
+		}
+
+		t.Logf("Attempt %d of WSL command %q failed with exit code %d. Retrying in %s.", attempt, linuxCmd, exitCode(err), backoff)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// assertWslLoginCommand runs the Linux command in the distro under test through a login shell, and returns its stdout.
+// Commands run with assertWslCommand go through the default user's shell too, but as a non-login shell:
+// profile scripts (/etc/profile, /etc/profile.d/*, ~/.profile) are not read, so variables such as PATH
+// entries or locale settings exported there are missing. Use this helper to check the environment users
+// get in their terminal.
+// Fails if the command could not be run or returned a non-zero exit code.
+func assertWslLoginCommand(t *testing.T, ctx context.Context, linuxCmd ...string) string {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	stdout, _, err := runCommand(ctx, wslLoginCommand(ctx, linuxCmd...))
+	require.NoErrorf(t, err, "Unexpected error running %q in a login shell", linuxCmd)
+
+	return stdout
+}
+
+// assertWslCommandAsUser runs the Linux command in the distro under test as the specified user, and returns its stdout.
+// Fails if the command could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertWslCommandAsUser(t *testing.T, ctx context.Context, user string, linuxCmd ...string) string {
+	t.Helper()
+
+	stdout, _, err := runWslCommandAsUser(ctx, user, linuxCmd...)
+	require.NoErrorf(t, err, "Unexpected error running WSL command as user %q", user)
+
+	return stdout
+}
+
+// assertWslCommandStdin runs the Linux command in the distro under test, feeding it the specified input
+// through stdin, and returns its stdout. Stdin is closed once the input is consumed, so the command
+// receives EOF.
+// Fails if the command could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertWslCommandStdin(t *testing.T, ctx context.Context, stdin string, linuxCmd ...string) string {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	cmd := wslCommand(ctx, linuxCmd...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	stdout, _, err := runCommand(ctx, cmd)
+	require.NoError(t, err, "Unexpected error running WSL command with stdin")
+
+	return stdout
+}
+
+// assertWslCommandInDir runs the Linux command in the distro under test from the specified directory, and returns its stdout.
+// Fails if the command could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertWslCommandInDir(t *testing.T, ctx context.Context, dir string, linuxCmd ...string) string {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	stdout, _, err := runCommand(ctx, wslCommandInDir(ctx, dir, linuxCmd...))
+	require.NoErrorf(t, err, "Unexpected error running WSL command in directory %q", dir)
+
+	return stdout
+}
+
+// assertWslExitCode runs the Linux command in the distro under test, and returns its stdout.
+// Fails if the command exits with a code other than the expected one.
+func assertWslExitCode(t *testing.T, ctx context.Context, want int, linuxCmd ...string) string {
+	t.Helper()
+
+	stdout, stderr, err := runWslCommand(ctx, linuxCmd...)
+	if !checkWslExitCode(t, want, linuxCmd, stdout, stderr, err) {
+		t.FailNow()
+	}
+
+	return stdout
+}
+
+// checkWslExitCode reports a failure, without stopping the test, if err is not the result of the Linux command
+// exiting with the expected code. It returns whether the exit code was the expected one.
+func checkWslExitCode(t *testing.T, want int, linuxCmd []string, stdout, stderr string, err error) bool {
+	t.Helper()
+
+	return assert.Equalf(t, want, exitCode(err), "Unexpected exit code for WSL command %q.\nError: %v\nStdout: %s\nStderr: %s", linuxCmd, err, stdout, stderr)
+}
+
+// runLauncherCommand runs the launcher with the specified verb and arguments, and returns its stdout.
+// Unlike assertLauncherCommand, it does not fail the test. The returned error wraps the
+// underlying *exec.ExitError, so the exit code can be inspected with errors.As, and
+// its message contains the last lines of stdout and stderr.
+// If ctx has no deadline, defaultTimeout is applied.
+func runLauncherCommand(ctx context.Context, verb string, args ...string) (string, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	stdout, _, err := runCommand(ctx, launcherCommand(ctx, verb, args...))
+	return stdout, err
+}
+
+// assertLauncherCommand runs the launcher with the specified verb and arguments, and returns its stdout.
+// Fails if the launcher could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertLauncherCommand(t *testing.T, ctx context.Context, verb string, args ...string) string {
+	t.Helper()
+
+	out, err := runLauncherCommand(ctx, verb, args...)
+	require.NoError(t, err, "Unexpected error running the launcher")
+
+	return out
+}
+
+// assertLauncherCommandStdin runs the launcher with the specified verb and arguments, feeding it the
+// specified input through stdin, and returns its stdout. Stdin is closed once the input is consumed,
+// so the launcher receives EOF. The launcher is started without PowerShell (see directLauncherCommand).
+// Fails if the launcher could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertLauncherCommandStdin(t *testing.T, ctx context.Context, stdin string, verb string, args ...string) string {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	cmd := directLauncherCommand(ctx, verb, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	stdout, _, err := runCommand(ctx, cmd)
+	require.NoError(t, err, "Unexpected error running the launcher with stdin")
+
+	return stdout
+}
+
+// assertLauncherFails runs the launcher with the specified verb and arguments, and returns its output.
+// The launcher reports errors on stdout, so the output contains both stdout and stderr, in the order they were written.
+// Fails if the launcher could not be started or exited successfully.
+func assertLauncherFails(t *testing.T, ctx context.Context, verb string, args ...string) string {
+	t.Helper()
+
+	out, err := runLauncherCommand(ctx, verb, args...)
+	if err == nil {
+		t.Fatalf("Launcher verb %q with args %q should have failed, but it exited successfully. Stdout:\n%s", verb, args, out)
+	}
+
+	var target *commandError
+	require.ErrorAs(t, err, &target, "Unexpected error running the launcher")
+	require.NotEqualf(t, -1, target.exitCode, "Launcher could not be started: %v", err)
+
+	return target.output
+}
+
+// assertLauncherFailsWith runs the launcher with the specified verb and arguments, and returns its output.
+// Fails if the launcher exited successfully or its output does not contain want.
+func assertLauncherFailsWith(t *testing.T, ctx context.Context, want string, verb string, args ...string) string {
+	t.Helper()
+
+	out := assertLauncherFails(t, ctx, verb, args...)
+	require.Containsf(t, out, want, "Launcher verb %q with args %q failed with an unexpected message", verb, args)
+
+	return out
+}
+
+// timeLauncherCommand runs the launcher with the specified verb and arguments, and returns its stdout
+// along with the wall-clock time the launcher took to run.
+// Fails if the launcher could not be run or returned a non-zero exit code.
+func timeLauncherCommand(t *testing.T, ctx context.Context, verb string, args ...string) (string, time.Duration) {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	cmd := launcherCommand(ctx, verb, args...)
+
+	start := time.Now()
+	stdout, _, err := runCommand(ctx, cmd)
+	elapsed := time.Since(start)
+
+	require.NoError(t, err, "Unexpected error running the launcher")
+	t.Logf("Launcher verb %q with args %q took %s", verb, args, elapsed.Round(time.Millisecond))
+
+	return stdout, elapsed
+}
+
+// assertLauncherFasterThan runs the launcher with the specified verb and arguments, and returns its stdout.
+// Fails if the launcher returned a non-zero exit code or took longer than limit to run.
+func assertLauncherFasterThan(t *testing.T, ctx context.Context, limit time.Duration, verb string, args ...string) string {
+	t.Helper()
+
+	out, elapsed := timeLauncherCommand(t, ctx, verb, args...)
+	require.LessOrEqualf(t, elapsed, limit, "Launcher verb %q with args %q took %s, expected at most %s", verb, args, elapsed.Round(time.Millisecond), limit)
+
+	return out
+}
+
+// runPowerShell runs the PowerShell script on the Windows host, and returns its stdout and stderr.
+// Unlike assertPowerShell, it does not fail the test.
+// If ctx has no deadline, defaultTimeout is applied.
+func runPowerShell(ctx context.Context, script string) (stdout, stderr string, err error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	return runCommand(ctx, powershellCommand(ctx, script))
+}
+
+// assertPowerShell runs the PowerShell script on the Windows host, and returns its stdout.
+// Fails if the script could not be run or returned a non-zero exit code. The failure message includes stderr.
+func assertPowerShell(t *testing.T, ctx context.Context, script string) string {
+	t.Helper()
+
+	stdout, _, err := runPowerShell(ctx, script)
+	require.NoErrorf(t, err, "Unexpected error running PowerShell script:\n%s", script)
+
+	return stdout
+}
+
+// assertLauncherInstall installs the distro with the launcher, and returns its stdout.
+// Fails if the installation did not succeed.
+func assertLauncherInstall(t *testing.T, ctx context.Context, opts launcherInstallOptions) string {
+	t.Helper()
+
+	return assertLauncherCommand(t, ctx, "install", opts.args()...)
+}
+
+// installState is the state of the distro that installing it again must not change.
+type installState struct {
+	defaultUser string
+	defaultUID  int
+	packages    string
+}
+
+// captureInstallState returns the default user and installed packages of the distro under test.
+// Fails if they cannot be determined.
+func captureInstallState(t *testing.T, ctx context.Context) installState {
+	t.Helper()
+
+	user, err := defaultUser(ctx)
+	require.NoError(t, err, "Could not find the default user")
+
+	uid, err := registryDefaultUID(ctx)
+	require.NoError(t, err, "Could not find the default UID")
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	// --exec so that the format reaches dpkg-query unexpanded.
+	packages, _, err := runCommand(ctx, rootExecCommand(ctx, "dpkg-query", "--show", `--showformat=${Package} ${Version}\n`))
+	require.NoError(t, err, "Could not list installed packages")
+
+	return installState{defaultUser: user, defaultUID: uid, packages: packages}
+}
+
+// assertInstallIdempotent runs the launcher's install verb on the already installed distro under test, and
+// fails if it changes the default user or the installed packages, or if the distro ends up unregistered.
+// The second installation may either succeed or fail: the launcher exits with code 1 without doing anything
+// when the distro is already registered.
+func assertInstallIdempotent(t *testing.T, ctx context.Context, opts launcherInstallOptions) {
+	t.Helper()
+
+	assertRegistered(t)
+	before := captureInstallState(t, ctx)
+
+	out, err := runLauncherCommand(ctx, "install", opts.args()...)
+	t.Logf("Second installation exited with code %d. Output:\n%s", exitCode(err), out)
+	require.NotEqualf(t, -1, exitCode(err), "Could not run the launcher: %v", err)
+	require.NotContains(t, out, "Installation successful!", "The distro should not have been installed a second time")
+
+	assertRegistered(t)
+	after := captureInstallState(t, ctx)
+
+	require.Equal(t, before.defaultUser, after.defaultUser, "Installing again should not change the default user")
+	require.Equal(t, before.defaultUID, after.defaultUID, "Installing again should not change the default UID")
+	require.Equal(t, before.packages, after.packages, "Installing again should not change the installed packages")
+}
+
+// assertLauncherRun runs the Linux command in the distro with the launcher's run verb, and returns its stdout.
+// The launcher joins the arguments with spaces and hands them to the default user's shell.
+// Fails if the launcher could not be run or the command returned a non-zero exit code.
+func assertLauncherRun(t *testing.T, ctx context.Context, linuxCmd ...string) string {
+	t.Helper()
+
+	return assertLauncherCommand(t, ctx, "run", linuxCmd...)
+}
+
+// assertLauncherConfig runs the launcher's config verb with the specified arguments, and returns its stdout.
+// Fails if the launcher could not be run or the configuration was rejected.
+func assertLauncherConfig(t *testing.T, ctx context.Context, args ...string) string {
+	t.Helper()
+
+	return assertLauncherCommand(t, ctx, "config", args...)
+}
+
+// assertLauncherSetDefaultUser makes name the default user of the distro with the launcher's config verb,
+// and returns its stdout.
+// Fails if the launcher could not be run or the user could not be set as default.
+func assertLauncherSetDefaultUser(t *testing.T, ctx context.Context, name string) string {
+	t.Helper()
+
+	return assertLauncherConfig(t, ctx, "--default-user", name)
+}
+
+// assertLauncherExitCode runs the launcher with the specified verb and arguments, and returns its stdout.
+// Fails if the launcher exits with a code other than the expected one.
+func assertLauncherExitCode(t *testing.T, ctx context.Context, want int, verb string, args ...string) string {
+	t.Helper()
+
+	out, err := runLauncherCommand(ctx, verb, args...)
+	require.Equalf(t, want, exitCode(err), "Unexpected exit code for launcher verb %q with args %q.\nError: %v\nStdout: %s", verb, args, err, out)
+
+	return out
+}
+
+// exitCode returns the exit code of a command given the error it returned.
+// It returns 0 for a nil error, and -1 if the error does not carry an exit code
+// (e.g. the command could not be started).
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var target *exec.ExitError
+	if !errors.As(err, &target) {
+		return -1
+	}
+
+	return target.ExitCode()
 }
 
 // checkValidTestbed checks that the test environment is valid.
@@ -74,10 +801,75 @@ func checkValidTestbed(t *testing.T) {
 	require.Equal(t, "DistroNotFound", status, "Setup: the tested distro is registered. Make a backup and unregister it before running the tests.")
 }
 
+// terminateDistro terminates the distro under test. The next command run in the distro will cold-start it.
 func terminateDistro(t *testing.T) {
 	t.Helper()
+
+	t.Logf("Terminating distro %q", *distroName)
 	out, err := exec.Command("wsl.exe", "--terminate", *distroName).CombinedOutput()
-	require.NoError(t, err, "Failed to shut down WLS: %s", out)
+	require.NoError(t, err, "Failed to terminate distro: %s", decodeWslOutput(out))
+}
+
+// shutdownWSL shuts down the WSL virtual machine, terminating all running distros.
+func shutdownWSL(t *testing.T) {
+	t.Helper()
+
+	t.Log("Shutting WSL down")
+	out, err := exec.Command("wsl.exe", "--shutdown").CombinedOutput()
+	require.NoError(t, err, "Failed to shut down WSL: %s", decodeWslOutput(out))
+}
+
+// waitForBoot waits until the distro targeted by ctx has fully booted: a trivial command must succeed and,
+// if systemd is enabled, systemd must report the system as running or degraded.
+// Fails if the distro has not booted before the timeout.
+func waitForBoot(t *testing.T, ctx context.Context, timeout time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t.Logf("Waiting for distro %q to boot", targetDistro(ctx))
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	poll := func(done func() (bool, string)) {
+		for attempt := 1; ; attempt++ {
+			ok, status := done()
+			if ok {
+				return
+			}
+			t.Logf("Boot poll %d: %s", attempt, status)
+
+			select {
+			case <-ctx.Done():
+				require.Failf(t, "Distro did not boot in time", "Last status after %d attempts: %s", attempt, status)
+			case <-ticker.C:
+			}
+		}
+	}
+
+	poll(func() (bool, string) {
+		_, _, err := runWslCommand(ctx, "true")
+		if err != nil {
+			return false, fmt.Sprintf("distro not responding (exit code %d)", exitCode(err))
+		}
+		return true, ""
+	})
+
+	if !systemdEnabled(t, ctx) {
+		t.Log("Distro booted")
+		return
+	}
+
+	poll(func() (bool, string) {
+		// Non-zero exit codes are expected while booting: only the output matters.
+		stdout, _, _ := runWslCommand(ctx, "systemctl", "is-system-running")
+		status := strings.TrimSpace(stdout)
+		return status == "running" || status == "degraded", "systemd is " + status
+	})
+
+	t.Log("Distro booted")
 }
 
 // distroState parses the output of "wsl -l -v" to find the state of the current distro.
@@ -87,38 +879,178 @@ func distroState(t *testing.T) string {
 
 	const distroNotFoundMsg = "DistroNotFound"
 
+	distros, err := listDistros()
+	require.NoError(t, err, "Could not find the state of the distro")
+
+	for _, d := range distros {
+		if d.name == *distroName {
+			return d.state
+		}
+	}
+
+	return distroNotFoundMsg
+}
+
+// distroInfo is the information about a registered distro reported by "wsl -l -v".
+type distroInfo struct {
+	name      string
+	state     string // Running, Stopped, Installing, etc.
+	version   int    // WSL version: 1 or 2
+	isDefault bool
+}
+
+// listDistros parses the output of "wsl -l -v" to find the registered distros.
+// No distros and no error are returned if there are no distros registered.
+func listDistros() ([]distroInfo, error) {
 	// wsl -l -v outputs UTF-16 (See https://github.com/microsoft/WSL/issues/4607)
-	// We use $env:WSL_UTF8=1 to prevent this (Available from 0.64.0 onwards https://github.com/microsoft/WSL/releases/tag/0.64.0)
-	out, err := exec.Command("powershell.exe", "-noninteractive", "-nologo", "-noprofile", "-command", "$env:WSL_UTF8=1 ; wsl -l -v").CombinedOutput()
+	// We use WSL_UTF8=1 to prevent this (Available from 0.64.0 onwards https://github.com/microsoft/WSL/releases/tag/0.64.0),
+	// and fall back to decoding UTF-16 for older versions.
+	cmd := exec.Command("wsl.exe", "-l", "-v")
+	cmd.Env = append(os.Environ(), "WSL_UTF8=1")
+	raw, err := cmd.CombinedOutput()
+	out := decodeWslOutput(raw)
 	if err != nil {
 		// This error shows up when there is no distro installed
-		require.Containsf(t, string(out), "WSL_E_DEFAULT_DISTRO_NOT_FOUND", "Unexpected error calling 'wsl -l -v'. Error: %v\nOutput: %s", err, out)
-		return distroNotFoundMsg
+		if strings.Contains(out, "WSL_E_DEFAULT_DISTRO_NOT_FOUND") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unexpected error calling 'wsl -l -v': %v. Output: %s", err, out)
 	}
 
 	// Example line:
 	// * Ubuntu-22.04                      Stopped         2
-	// ↑ ↑~~~~~~~~~~~                      ↑~~~~~~
-	// | 2: Distro name                    3: Status
-	// 1: Default[*| ] (ignored)
-	pattern := regexp.MustCompile(`^(\*| ) ([a-zA-Z-_0-9.]+)\s+([a-zA-Z]+)\s+[0-9]$`)
+	// ↑ ↑~~~~~~~~~~~                      ↑~~~~~~         ↑
+	// | 2: Distro name                    3: Status       4: Version
+	// 1: Default[*| ]
+	pattern := regexp.MustCompile(`^(\*| ) ([a-zA-Z-_0-9.]+)\s+([a-zA-Z]+)\s+([0-9])$`)
+	const DefaultIdx = 1
 	const DistroNameIdx = 2
 	const DistroStateIdx = 3
+	const VersionIdx = 4
 
-	scanner := bufio.NewScanner(bytes.NewReader(out))
+	var distros []distroInfo
+	scanner := bufio.NewScanner(strings.NewReader(out))
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := strings.TrimRight(scanner.Text(), "\r")
 		m := pattern.FindStringSubmatch(line)
-		if len(m) != 4 {
+		if len(m) != 5 {
 			continue
 		}
-		if m[DistroNameIdx] != *distroName {
-			continue
+
+		version, err := strconv.Atoi(m[VersionIdx])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse WSL version in line %q: %v", line, err)
 		}
-		return m[DistroStateIdx]
+
+		distros = append(distros, distroInfo{
+			name:      m[DistroNameIdx],
+			state:     m[DistroStateIdx],
+			version:   version,
+			isDefault: m[DefaultIdx] == "*",
+		})
 	}
 
-	require.NoErrorf(t, scanner.Err(), "Unexpected error in scanner: %v", err)
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unexpected error in scanner: %v", err)
+	}
 
-	return distroNotFoundMsg
+	return distros, nil
+}
+
+// unregisterOnCleanup unregisters the distro at the end of the test, unless -keep-distro is set.
+func unregisterOnCleanup(t *testing.T, distro string) {
+	t.Helper()
+
+	t.Cleanup(func() {
+		if *keepDistro {
+			t.Logf("Keeping distro %q registered after test as requested", distro)
+			return
+		}
+
+		unregisterIfPresent(t, distro)
+	})
+}
+
+// unregisterIfPresent unregisters the distro if it is registered. It never fails the test, so it
+// is safe to use in cleanups even if the test already unregistered the distro, or if another cleanup
+// races to unregister it: a distro not found by WSL counts as unregistered. Problems are logged instead.
+func unregisterIfPresent(t *testing.T, distro string) {
+	t.Helper()
+
+	distros, err := listDistros()
+	if err != nil {
+		t.Logf("Could not list distros before unregistering %q, trying anyway: %v", distro, err)
+	} else if !slices.ContainsFunc(distros, func(d distroInfo) bool { return d.name == distro }) {
+		t.Logf("Distro %q is not registered: nothing to unregister", distro)
+		return
+	}
+
+	cmd := exec.Command("wsl.exe", "--unregister", distro)
+	cmd.Env = append(os.Environ(), "WSL_UTF8=1")
+	raw, err := cmd.CombinedOutput()
+	out := decodeWslOutput(raw)
+	if err != nil && strings.Contains(out, "WSL_E_DISTRO_NOT_FOUND") {
+		t.Logf("Distro %q was unregistered concurrently: nothing to unregister", distro)
+		return
+	}
+	if err != nil {
+		t.Logf("Failed to unregister distro %q: %v. Output: %s", distro, err, out)
+		return
+	}
+
+	t.Logf("Unregistered distro %q", distro)
+}
+
+// isRegistered parses the output of "wsl --list --quiet" to find out if the distro under test is registered.
+// Fails if the list of distros cannot be obtained.
+func isRegistered(t *testing.T) bool {
+	t.Helper()
+
+	raw, err := exec.Command("wsl.exe", "--list", "--quiet").CombinedOutput()
+	out := decodeWslOutput(raw)
+	if err != nil {
+		// This error shows up when there is no distro installed
+		require.Containsf(t, out, "WSL_E_DEFAULT_DISTRO_NOT_FOUND", "Unexpected error calling 'wsl --list --quiet'. Error: %v\nOutput: %s", err, out)
+		return false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == *distroName {
+			return true
+		}
+	}
+	require.NoErrorf(t, scanner.Err(), "Unexpected error in scanner")
+
+	return false
+}
+
+// assertRegistered fails if the distro under test is not registered.
+func assertRegistered(t *testing.T) {
+	t.Helper()
+
+	require.Truef(t, isRegistered(t), "Distro %q should be registered", *distroName)
+}
+
+// assertNotRegistered fails if the distro under test is registered.
+func assertNotRegistered(t *testing.T) {
+	t.Helper()
+
+	require.Falsef(t, isRegistered(t), "Distro %q should not be registered", *distroName)
+}
+
+// decodeWslOutput converts the output of wsl.exe management commands into a string.
+// Such output is encoded as UTF-16LE unless $env:WSL_UTF8=1 is set (See https://github.com/microsoft/WSL/issues/4607),
+// so it is decoded only if it looks like UTF-16.
+func decodeWslOutput(out []byte) string {
+	if len(out)%2 != 0 || !bytes.ContainsRune(out, 0) {
+		return string(out)
+	}
+
+	u16 := make([]uint16, len(out)/2)
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(out[2*i:])
+	}
+
+	return strings.TrimPrefix(string(utf16.Decode(u16)), "\ufeff") // Byte order mark
 }
@@ -0,0 +1,78 @@
+package launchertester
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lxssKey is the registry key under which WSL stores a subkey per registered distro.
+const lxssKey = `HKCU:\Software\Microsoft\Windows\CurrentVersion\Lxss`
+
+// registryEntry returns the name of the subkey that WSL stores in the registry for the distro targeted by ctx
+// (a GUID), along with the directory where the distro is installed (its BasePath).
+func registryEntry(ctx context.Context) (subkey, basePath string, err error) {
+	distro := targetDistro(ctx)
+
+	script := fmt.Sprintf(`Get-ChildItem %s | `+
+		`Where-Object { $_.GetValue('DistributionName') -eq %s } | `+
+		`ForEach-Object { $_.PSChildName; $_.GetValue('BasePath') }`, lxssKey, powershellQuote(distro))
+
+	out, _, err := runPowerShell(ctx, script)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read the registry of distro %q: %w", distro, err)
+	}
+
+	// Not splitting on whitespace: the path may contain spaces.
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(out, "\r", "")), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("could not find distro %q in the registry. Output: %s", distro, out)
+	}
+
+	// BasePath can be stored with the extended-length prefix.
+	return lines[0], strings.TrimPrefix(lines[1], `\\?\`), nil
+}
+
+// assertFullyUnregistered unregisters the distro targeted by ctx, and fails if anything is left behind:
+// the distro in the list of WSL, its registry subkey, or its disk (ext4.vhdx for WSL 2, rootfs for WSL 1).
+// All leftovers are listed in the failure message.
+func assertFullyUnregistered(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	distro := targetDistro(ctx)
+
+	subkey, basePath, err := registryEntry(ctx)
+	require.NoError(t, err, "Setup: could not find where the distro is installed")
+
+	out, err := exec.CommandContext(ctx, "wsl.exe", "--unregister", distro).CombinedOutput()
+	require.NoErrorf(t, err, "Failed to unregister distro %q: %s", distro, decodeWslOutput(out))
+
+	var leftovers []string
+
+	distros, err := listDistros()
+	require.NoError(t, err, "Could not list registered distros")
+	if slices.ContainsFunc(distros, func(d distroInfo) bool { return d.name == distro }) {
+		leftovers = append(leftovers, "distro is still listed by 'wsl --list'")
+	}
+
+	exists := assertPowerShell(t, ctx, fmt.Sprintf(`Test-Path %s`, powershellQuote(lxssKey+`\`+subkey)))
+	if strings.TrimSpace(exists) != "False" {
+		leftovers = append(leftovers, fmt.Sprintf(`registry key %s\%s still exists`, lxssKey, subkey))
+	}
+
+	for _, disk := range []string{"ext4.vhdx", "rootfs"} {
+		path := filepath.Join(basePath, disk)
+		if _, err := os.Lstat(path); err == nil {
+			leftovers = append(leftovers, fmt.Sprintf("%s still exists", path))
+		}
+	}
+
+	require.Emptyf(t, leftovers, "Unregistering distro %q left artifacts behind:\n%s", distro, strings.Join(leftovers, "\n"))
+}
@@ -0,0 +1,34 @@
+package launchertester
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// expandWindowsEnv replaces the %VARIABLE% references in s with the values of the environment
+// variables of the Windows host. References to unset variables are left untouched, as cmd.exe does.
+func expandWindowsEnv(s string) string {
+	return regexp.MustCompile(`%([^%]+)%`).ReplaceAllStringFunc(s, func(ref string) string {
+		if v, ok := os.LookupEnv(ref[1 : len(ref)-1]); ok {
+			return v
+		}
+		return ref
+	})
+}
+
+// assertFileExistsWindows fails if nothing exists at the path on the Windows host. Environment variables
+// such as %APPDATA% in the path are expanded. It returns the expanded path.
+func assertFileExistsWindows(t *testing.T, path string) string {
+	t.Helper()
+
+	path = expandWindowsEnv(path)
+
+	// Lstat so that app execution aliases and other reparse points are found too.
+	_, err := os.Lstat(path)
+	require.NoErrorf(t, err, "%s should exist on the Windows host", path)
+
+	return path
+}
@@ -0,0 +1,181 @@
+package launchertester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/ini.v1"
+)
+
+// wslConf is the typed contents of /etc/wsl.conf. Missing keys take the defaults WSL uses.
+// Keys that are not modelled are kept as they are when the configuration is written back.
+type wslConf struct {
+	Boot struct {
+		Systemd bool
+		Command string
+	}
+	Automount struct {
+		Enabled    bool
+		Root       string
+		Options    string
+		MountFsTab bool
+	}
+	Network struct {
+		GenerateHosts      bool
+		GenerateResolvConf bool
+		Hostname           string
+	}
+	Interop struct {
+		Enabled           bool
+		AppendWindowsPath bool
+	}
+	User struct {
+		Default string
+	}
+
+	// raw is the parsed file, holding the keys that are not modelled.
+	raw *ini.File
+}
+
+// wslConfKey binds a field of wslConf to its key in /etc/wsl.conf.
+type wslConfKey struct {
+	section, key string
+	value        any // *bool or *string
+}
+
+// keys returns the bindings between the fields of c and the keys in /etc/wsl.conf.
+func (c *wslConf) keys() []wslConfKey {
+	return []wslConfKey{
+		{"boot", "systemd", &c.Boot.Systemd},
+		{"boot", "command", &c.Boot.Command},
+		{"automount", "enabled", &c.Automount.Enabled},
+		{"automount", "root", &c.Automount.Root},
+		{"automount", "options", &c.Automount.Options},
+		{"automount", "mountFsTab", &c.Automount.MountFsTab},
+		{"network", "generateHosts", &c.Network.GenerateHosts},
+		{"network", "generateResolvConf", &c.Network.GenerateResolvConf},
+		{"network", "hostname", &c.Network.Hostname},
+		{"interop", "enabled", &c.Interop.Enabled},
+		{"interop", "appendWindowsPath", &c.Interop.AppendWindowsPath},
+		{"user", "default", &c.User.Default},
+	}
+}
+
+// newWslConf returns the configuration WSL uses when /etc/wsl.conf is empty.
+func newWslConf() *wslConf {
+	c := &wslConf{raw: ini.Empty()}
+	c.Automount.Enabled = true
+	c.Automount.Root = "/mnt/"
+	c.Automount.MountFsTab = true
+	c.Network.GenerateHosts = true
+	c.Network.GenerateResolvConf = true
+	c.Interop.Enabled = true
+	c.Interop.AppendWindowsPath = true
+	return c
+}
+
+// readWslConf reads and parses /etc/wsl.conf in the distro targeted by ctx.
+func readWslConf(ctx context.Context) (*wslConf, error) {
+	raw, err := loadWslConf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newWslConf()
+	c.raw = raw
+	for _, k := range c.keys() {
+		if !raw.Section(k.section).HasKey(k.key) {
+			continue
+		}
+		key := raw.Section(k.section).Key(k.key)
+		switch v := k.value.(type) {
+		case *bool:
+			b, err := key.Bool()
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for [%s] %s in /etc/wsl.conf: %v", k.section, k.key, err)
+			}
+			*v = b
+		case *string:
+			*v = key.String()
+		}
+	}
+
+	return c, nil
+}
+
+// marshal returns the contents of /etc/wsl.conf for c. Modelled keys are only written
+// if they were already in the file or differ from their default.
+func (c *wslConf) marshal() ([]byte, error) {
+	// Work on a copy so that c is left untouched.
+	raw := ini.Empty()
+	if c.raw != nil {
+		var buf bytes.Buffer
+		if _, err := c.raw.WriteTo(&buf); err != nil {
+			return nil, err
+		}
+		var err error
+		if raw, err = ini.Load(buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	defaults := newWslConf()
+	defaultKeys := defaults.keys()
+
+	for i, k := range c.keys() {
+		var value, defaultValue string
+		switch v := k.value.(type) {
+		case *bool:
+			value = strconv.FormatBool(*v)
+			defaultValue = strconv.FormatBool(*defaultKeys[i].value.(*bool))
+		case *string:
+			value = *v
+			defaultValue = *defaultKeys[i].value.(*string)
+		}
+
+		if !raw.Section(k.section).HasKey(k.key) && value == defaultValue {
+			continue
+		}
+		raw.Section(k.section).Key(k.key).SetValue(value)
+	}
+
+	var buf bytes.Buffer
+	if _, err := raw.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeWslConf writes c as /etc/wsl.conf in the distro targeted by ctx, as root.
+// Changes take effect the next time the distro boots.
+// Fails if the file cannot be written.
+func writeWslConf(t *testing.T, ctx context.Context, c *wslConf) {
+	t.Helper()
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	contents, err := c.marshal()
+	require.NoError(t, err, "Could not serialize wsl.conf")
+
+	cmd := rootExecCommand(ctx, "dd", "of=/etc/wsl.conf", "status=none")
+	cmd.Stdin = bytes.NewReader(contents)
+	_, _, err = runCommand(ctx, cmd)
+	require.NoError(t, err, "Could not write /etc/wsl.conf")
+}
+
+// assertWslConf fails if /etc/wsl.conf in the distro targeted by ctx cannot be read, or if
+// check returns false for its contents.
+func assertWslConf(t *testing.T, ctx context.Context, check func(*wslConf) bool) {
+	t.Helper()
+
+	c, err := readWslConf(ctx)
+	require.NoError(t, err, "Could not read wsl.conf")
+
+	contents, err := c.marshal()
+	require.NoError(t, err, "Could not serialize wsl.conf")
+	require.Truef(t, check(c), "wsl.conf does not match expectations. Contents:\n%s", contents)
+}
@@ -0,0 +1,110 @@
+package launchertester
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setDefaultVersion sets the WSL version used for distros registered from now on, and restores
+// the previous default at the end of the test.
+// It returns an error if the version is not supported by the host.
+func setDefaultVersion(t *testing.T, ctx context.Context, version int) error {
+	t.Helper()
+
+	previous, err := defaultVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := runSetVersion(ctx, "--set-default-version", strconv.Itoa(version)); err != nil {
+		return err
+	}
+
+	t.Cleanup(func() {
+		if err := runSetVersion(context.Background(), "--set-default-version", strconv.Itoa(previous)); err != nil {
+			t.Logf("Failed to restore default WSL version %d: %v", previous, err)
+		}
+	})
+
+	return nil
+}
+
+// setDistroVersion converts the distro targeted by ctx to the specified WSL version.
+// Fails if the conversion does not succeed.
+func setDistroVersion(t *testing.T, ctx context.Context, version int) {
+	t.Helper()
+
+	distro := targetDistro(ctx)
+	t.Logf("Converting distro %q to WSL%d", distro, version)
+
+	err := runSetVersion(ctx, "--set-version", distro, strconv.Itoa(version))
+	require.NoErrorf(t, err, "Could not convert distro %q to WSL%d", distro, version)
+}
+
+// assertDistroVersion fails if the distro targeted by ctx is not registered with the expected WSL version.
+func assertDistroVersion(t *testing.T, ctx context.Context, want int) {
+	t.Helper()
+
+	distros, err := listDistros()
+	require.NoError(t, err, "Could not list registered distros")
+
+	distro := targetDistro(ctx)
+	i := slices.IndexFunc(distros, func(d distroInfo) bool { return d.name == distro })
+	require.NotEqualf(t, -1, i, "Distro %q should be registered", distro)
+	require.Equalf(t, want, distros[i].version, "Distro %q should be registered as WSL%d", distro, want)
+}
+
+// forEachWSLVersion runs f in a subtest for each WSL version, with that version set as the default one.
+// Versions not supported by the host are skipped.
+func forEachWSLVersion(t *testing.T, f func(t *testing.T, version int)) {
+	t.Helper()
+
+	for _, version := range []int{1, 2} {
+		version := version
+		t.Run(fmt.Sprintf("WSL%d", version), func(t *testing.T) {
+			if err := setDefaultVersion(t, context.Background(), version); err != nil {
+				t.Skipf("Skipped: WSL%d is not supported on this host: %v", version, err)
+			}
+
+			f(t, version)
+		})
+	}
+}
+
+// defaultVersion returns the WSL version used for newly registered distros, as stored in the registry.
+func defaultVersion(ctx context.Context) (int, error) {
+	const script = `(Get-ItemProperty HKCU:\Software\Microsoft\Windows\CurrentVersion\Lxss).DefaultVersion`
+
+	stdout, _, err := runPowerShell(ctx, script)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the default WSL version from the registry: %w", err)
+	}
+
+	out := strings.TrimSpace(stdout)
+	if out == "" {
+		return 2, nil // WSL2 is the default unless stated otherwise
+	}
+
+	version, err := strconv.Atoi(out)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the default WSL version %q: %v", out, err)
+	}
+
+	return version, nil
+}
+
+// runSetVersion runs wsl.exe with the specified version-setting arguments.
+func runSetVersion(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "wsl.exe", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("'wsl %s' failed: %v. Output: %s", strings.Join(args, " "), err, decodeWslOutput(out))
+	}
+	return nil
+}
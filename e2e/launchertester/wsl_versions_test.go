@@ -0,0 +1,30 @@
+package launchertester
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestWSLVersions installs the distro with each WSL version as the default one of the host, and runs
+// the assertions whose outcome depends on the WSL version.
+func TestWSLVersions(t *testing.T) {
+	forEachWSLVersion(t, func(t *testing.T, version int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		freshInstall(t, ctx, launcherInstallOptions{root: true})
+		assertDistroVersion(t, ctx, version)
+
+		testCases := map[string]func(t *testing.T){
+			"DistroIsUbuntu":        testDistroIsUbuntu,
+			"InteropIsEnabled":      testInteropIsEnabled,
+			"WindowsDriveIsMounted": testWindowsDriveIsMounted,
+			"NetworkWorks":          testNetworkWorks,
+		}
+
+		for name, tc := range testCases {
+			t.Run(name, tc)
+		}
+	})
+}
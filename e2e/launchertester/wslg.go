@@ -0,0 +1,53 @@
+package launchertester
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// wslgAvailable returns true if the distro targeted by ctx is wired up to WSLg: both DISPLAY and
+// WAYLAND_DISPLAY are set, and the X11 socket directory exists. The detected values are logged.
+func wslgAvailable(t *testing.T, ctx context.Context) bool {
+	t.Helper()
+
+	// printenv fails if the variable is not set: only the output matters.
+	display, _, _ := runWslCommand(ctx, "printenv", "DISPLAY")
+	waylandDisplay, _, _ := runWslCommand(ctx, "printenv", "WAYLAND_DISPLAY")
+	display, waylandDisplay = strings.TrimSpace(display), strings.TrimSpace(waylandDisplay)
+	x11Socket := fileExists(t, ctx, "/tmp/.X11-unix")
+
+	t.Logf("WSLg: DISPLAY=%q WAYLAND_DISPLAY=%q /tmp/.X11-unix exists: %t", display, waylandDisplay, x11Socket)
+
+	return display != "" && waylandDisplay != "" && x11Socket
+}
+
+// skipIfNoWSLg skips the test if the host cannot provide WSLg to the distro targeted by ctx:
+// either WSL does not report a WSLg version, or the distro does not run on WSL 2.
+func skipIfNoWSLg(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	v, err := wslVersion(ctx)
+	if err != nil || v.wslg == "" {
+		t.Skipf("Skipped: the host WSL does not report a WSLg version: %v", err)
+	}
+
+	distros, err := listDistros()
+	require.NoError(t, err, "Could not find the WSL version of the distro")
+	for _, d := range distros {
+		if d.name == targetDistro(ctx) && d.version != 2 {
+			t.Skipf("Skipped: WSLg requires WSL 2, but distro %q runs on WSL %d", d.name, d.version)
+		}
+	}
+}
+
+// assertWSLgAvailable fails if the distro targeted by ctx is not wired up to WSLg.
+// The test is skipped if the host cannot provide WSLg.
+func assertWSLgAvailable(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	skipIfNoWSLg(t, ctx)
+	require.True(t, wslgAvailable(t, ctx), "WSLg should be available: DISPLAY and WAYLAND_DISPLAY should be set and /tmp/.X11-unix should exist")
+}